@@ -3,6 +3,7 @@
 REM Build the Go applications
 go build -o funtech-web-server.exe funtech_web_server.go
 go build -o funtech-daemon.exe funtech_daemon.go
+go build -o funtech-admin.exe funtech_admin.go
 
 REM Check if the build was successful
 if not exist funtech-daemon.exe (
@@ -3,33 +3,59 @@ package config
 import (
 	"encoding/json"
 	"fmt"
+	"log"
 	"os"
 	"sync"
 )
 
-var (
-	AuthCode  string
-	mu        sync.Mutex
-	authCodes = make(map[string]string)
-)
+// mu serialises reading and writing user configs within the process; lockFile does so across processes
+var mu sync.Mutex
 
 type CommonConfig struct {
-	GoogleClientID     string `json:"google_client_id"`
-	GoogleClientSecret string `json:"google_client_secret"`
-	GoogleRedirectURI  string `json:"google_redirect_uri"`
+	GoogleClientID       string  `json:"google_client_id"`
+	GoogleClientSecret   string  `json:"google_client_secret"`
+	GoogleRedirectURI    string  `json:"google_redirect_uri"`
+	PortalBackend        string  `json:"portal_backend"`      // "http" (default), "playwright" or "fixtures"
+	PortalFixturesDir    string  `json:"portal_fixtures_dir"` // Recorded portal pages used by the "fixtures" backend
+	PortalBaseURL        string  `json:"portal_base_url"`     // Defaults to https://funtech.co.uk
+	MaxDeleteFraction    float64 `json:"max_delete_fraction"` // Largest share of stored lessons or synced events a pass may delete; defaults to 0.5
+	SMTPHost             string  `json:"smtp_host"`           // Mail server for lesson change emails; emails are off without it
+	SMTPPort             int     `json:"smtp_port"`           // Defaults to 587
+	SMTPUsername         string  `json:"smtp_username"`
+	SMTPPassword         string  `json:"smtp_password"`
+	SMTPFrom             string  `json:"smtp_from"`
+	UserStore            string  `json:"user_store"`            // "json" (default) keeps users in config/user_configs, "sqlite" in the database
+	AvailabilityUsername string  `json:"availability_username"` // Portal account the term weeks are read with for all users; defaults to each user's own
+	AvailabilityPassword string  `json:"availability_password"`
 }
 
 type UserConfig struct {
 	Username         string `json:"username"`
-	Password         string `json:"password"`
+	Password         string `json:"password"`          // FunTech portal password, used by the scraper
+	WebPasswordHash  string `json:"web_password_hash"` // bcrypt hash of the password for logging in to the site
 	GoogleCalendarID string `json:"google_calendar_id"`
 	AccessToken      string `json:"access_token"`
 	TokenType        string `json:"token_type"`
 	RefreshToken     string `json:"refresh_token"`
 	Expiry           string `json:"expiry"`
+	ApproveNextSync  bool   `json:"approve_next_sync"` // Lets the next sync through the mass-deletion guard once
+	AdoptUntagged    bool   `json:"adopt_untagged"`    // Lets the next sync take over matching events it did not create, once
+	CalendarSink     string `json:"calendar_sink"`     // "google" (default), "ics", "caldav" or "feed"
+	ICSPath          string `json:"ics_path"`          // File written by the "ics" sink
+	CalDAVURL        string `json:"caldav_url"`        // Calendar collection used by the "caldav" sink
+	CalDAVUsername   string `json:"caldav_username"`
+	CalDAVPassword   string `json:"caldav_password"`
+	FeedToken        string `json:"feed_token"`         // Secret in the URL of the user's lesson feed
+	NotifyEmail      string `json:"notify_email"`       // Address emailed when lessons change
+	NotifyWebhookURL string `json:"notify_webhook_url"` // URL sent lesson changes as JSON
+	NeedsReauth      bool   `json:"needs_reauth"`       // Google rejected the saved token; syncs wait until the user reconnects
 }
 
-// LoadCommonConfig loads common configuration from a file
+// CalendarSinkFeed is the calendar sink of users who only subscribe to their lesson feed, so the
+// daemon has no calendar to sync for them.
+const CalendarSinkFeed = "feed"
+
+// LoadCommonConfig loads common configuration from a file, decrypting its passwords
 func LoadCommonConfig(filename string) (*CommonConfig, error) {
 	file, err := os.Open(filename)
 	if err != nil {
@@ -44,66 +70,43 @@ func LoadCommonConfig(filename string) (*CommonConfig, error) {
 		return nil, err
 	}
 
-	return config, nil
-}
-
-// LoadUserConfig loads the user configuration from a file
-func LoadUserConfig(filename string) (*UserConfig, error) {
-	file, err := os.Open(filename)
+	// Passwords are encrypted like those in the user configs, but the file is never rewritten
+	stale, err := config.decryptSecrets()
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("error decrypting %s: %v", filename, err)
 	}
-	defer file.Close()
-
-	decoder := json.NewDecoder(file)
-	config := &UserConfig{}
-	err = decoder.Decode(config)
-	if err != nil {
-		return nil, fmt.Errorf("error decoding user config for %s: %v", filename, err)
+	if stale {
+		log.Printf("Warning: passwords in %s are plaintext or encrypted with an old key, encrypt them with funtech-admin encrypt-secret", filename)
 	}
 
 	return config, nil
 }
 
-// SaveUserConfig atomically saves the user configuration to a file
-func SaveUserConfig(username string, config *UserConfig) error {
-	mu.Lock()
-	defer mu.Unlock()
+// EncodeUserConfig encodes the user config as JSON for storing, with its secrets encrypted.
+func EncodeUserConfig(config *UserConfig) ([]byte, error) {
+	stored := *config
+	if err := stored.encryptSecrets(); err != nil {
+		return nil, fmt.Errorf("error encrypting user config for %s: %v", config.Username, err)
+	}
 
-	// Write to a temporary file to avoid incomplete writes
-	tmpFilePath := "config/user_configs/" + username + ".json.tmp"
-	file, err := os.Create(tmpFilePath)
+	data, err := json.MarshalIndent(&stored, "", "  ")
 	if err != nil {
-		return fmt.Errorf("failed to create temp config file for %s: %v", username, err)
+		return nil, fmt.Errorf("error encoding user config for %s: %v", config.Username, err)
 	}
-	defer file.Close()
+	return append(data, '\n'), nil
+}
 
-	encoder := json.NewEncoder(file)
-	encoder.SetIndent("", "  ") // Optional: Makes the JSON more readable
-	if err := encoder.Encode(config); err != nil {
-		return fmt.Errorf("error encoding user config for %s: %v", username, err)
+// DecodeUserConfig decodes a user config stored by EncodeUserConfig and decrypts its secrets. It
+// reports whether the secrets need encrypting again with the current key.
+func DecodeUserConfig(data []byte) (*UserConfig, bool, error) {
+	config := &UserConfig{}
+	if err := json.Unmarshal(data, config); err != nil {
+		return nil, false, fmt.Errorf("error decoding user config: %v", err)
 	}
 
-	// Rename the temp file to the final file path
-	finalFilePath := "config/user_configs/" + username + ".json"
-	if err := os.Rename(tmpFilePath, finalFilePath); err != nil {
-		return fmt.Errorf("failed to rename temp config file for %s: %v", username, err)
+	stale, err := config.decryptSecrets()
+	if err != nil {
+		return nil, false, fmt.Errorf("error decrypting user config for %s: %v", config.Username, err)
 	}
-
-	return nil
-}
-
-// GetAuthCode retrieves the stored auth code for a given username
-func GetAuthCode(username string) (string, bool) {
-	mu.Lock()
-	defer mu.Unlock()
-	code, exists := authCodes[username]
-	return code, exists
-}
-
-// SetAuthCode sets an auth code for a user
-func SetAuthCode(username, code string) {
-	mu.Lock()
-	defer mu.Unlock()
-	authCodes[username] = code
+	return config, stale, nil
 }
@@ -0,0 +1,42 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+const (
+	lockRetryInterval = 50 * time.Millisecond
+	lockTimeout       = 10 * time.Second
+	// staleLockAge is how old a lock file must be before it is assumed to be left behind by a
+	// process that crashed while holding it. Locks are only held for a single read and write.
+	staleLockAge = 30 * time.Second
+)
+
+// lockFile locks filename against other processes, such as the daemon and the web server, by
+// creating filename.lock. It waits for a lock held elsewhere, and returns a function that unlocks it.
+func lockFile(filename string) (func(), error) {
+	lockName := filename + ".lock"
+	deadline := time.Now().Add(lockTimeout)
+	for {
+		file, err := os.OpenFile(lockName, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if err == nil {
+			fmt.Fprintf(file, "%d\n", os.Getpid())
+			file.Close()
+			return func() { os.Remove(lockName) }, nil
+		}
+		if !os.IsExist(err) {
+			return nil, fmt.Errorf("failed to lock %s: %v", filename, err)
+		}
+
+		if info, err := os.Stat(lockName); err == nil && time.Since(info.ModTime()) > staleLockAge {
+			os.Remove(lockName)
+			continue
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("timed out waiting for the lock on %s", filename)
+		}
+		time.Sleep(lockRetryInterval)
+	}
+}
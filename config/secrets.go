@@ -0,0 +1,247 @@
+package config
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+)
+
+const (
+	// SecretKeysEnv holds the encryption keys as comma-separated "id:key" pairs, where key is 32
+	// bytes of base64. The first key encrypts; the others are only used to decrypt old values.
+	SecretKeysEnv = "FTCALENDAR_SECRET_KEYS"
+	// SecretKeyFileEnv names a file holding one "id:key" pair per line, read when SecretKeysEnv is unset.
+	SecretKeyFileEnv     = "FTCALENDAR_SECRET_KEY_FILE"
+	defaultSecretKeyFile = "config/secret_keys"
+
+	encryptedPrefix = "enc:v1:"
+)
+
+// keyRing holds the keys secrets are encrypted with. current is the ID of the key new values are
+// encrypted with; it is empty when no key is configured and secrets are stored as plaintext.
+type keyRing struct {
+	current string
+	keys    map[string]cipher.AEAD
+}
+
+var (
+	secretKeysOnce sync.Once
+	secretKeys     *keyRing
+	secretKeysErr  error
+)
+
+// loadedKeyRing returns the configured keys, loading them the first time.
+func loadedKeyRing() (*keyRing, error) {
+	secretKeysOnce.Do(func() {
+		secretKeys, secretKeysErr = loadKeyRing()
+		if secretKeysErr == nil && secretKeys.current == "" {
+			log.Printf("Warning: no encryption key set in %s or %s, user passwords and tokens are stored as plaintext", SecretKeysEnv, defaultSecretKeyFile)
+		}
+	})
+	return secretKeys, secretKeysErr
+}
+
+// loadKeyRing reads the keys from the environment, or from the key file if the environment has none.
+func loadKeyRing() (*keyRing, error) {
+	var entries []string
+	if env := os.Getenv(SecretKeysEnv); env != "" {
+		entries = strings.Split(env, ",")
+	} else {
+		filename := os.Getenv(SecretKeyFileEnv)
+		if filename == "" {
+			filename = defaultSecretKeyFile
+		}
+		file, err := os.Open(filename)
+		if os.IsNotExist(err) && os.Getenv(SecretKeyFileEnv) == "" {
+			return &keyRing{}, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to open key file %s: %v", filename, err)
+		}
+		defer file.Close()
+
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			if line := strings.TrimSpace(scanner.Text()); line != "" && !strings.HasPrefix(line, "#") {
+				entries = append(entries, line)
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("failed to read key file %s: %v", filename, err)
+		}
+	}
+
+	ring := &keyRing{keys: make(map[string]cipher.AEAD)}
+	for _, entry := range entries {
+		id, encoded, ok := strings.Cut(strings.TrimSpace(entry), ":")
+		if !ok || id == "" {
+			return nil, fmt.Errorf("invalid encryption key %q: expected id:key", entry)
+		}
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil || len(key) != 32 {
+			return nil, fmt.Errorf("invalid encryption key %s: must be 32 bytes of base64", id)
+		}
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+		if _, exists := ring.keys[id]; exists {
+			return nil, fmt.Errorf("duplicate encryption key id %s", id)
+		}
+		ring.keys[id] = aead
+		if ring.current == "" {
+			ring.current = id
+		}
+	}
+	return ring, nil
+}
+
+// CurrentSecretKey returns the ID of the key new secrets are encrypted with, or "" when no key is
+// configured and secrets are stored as plaintext.
+func CurrentSecretKey() (string, error) {
+	ring, err := loadedKeyRing()
+	if err != nil {
+		return "", err
+	}
+	return ring.current, nil
+}
+
+// encrypt seals the value with the current key as "enc:v1:<key id>:<nonce and ciphertext>". The
+// field name is authenticated with it, so values cannot be swapped between fields. Empty values are
+// left as they are, as is everything when no key is configured.
+func (r *keyRing) encrypt(field, value string) (string, error) {
+	if value == "" || r.current == "" {
+		return value, nil
+	}
+
+	aead := r.keys[r.current]
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(value), []byte(field))
+	return encryptedPrefix + r.current + ":" + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// decrypt opens a value sealed by encrypt; other values are plaintext and returned as they are.
+// stale reports whether the value should be encrypted again: it is plaintext, or sealed with an
+// old key, while a current key is configured.
+func (r *keyRing) decrypt(field, value string) (plaintext string, stale bool, err error) {
+	if !strings.HasPrefix(value, encryptedPrefix) {
+		return value, value != "" && r.current != "", nil
+	}
+
+	id, encoded, ok := strings.Cut(strings.TrimPrefix(value, encryptedPrefix), ":")
+	if !ok {
+		return "", false, fmt.Errorf("malformed encrypted %s", field)
+	}
+	aead, ok := r.keys[id]
+	if !ok {
+		return "", false, fmt.Errorf("%s is encrypted with unknown key %s", field, id)
+	}
+	sealed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(sealed) < aead.NonceSize() {
+		return "", false, fmt.Errorf("malformed encrypted %s", field)
+	}
+	opened, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], []byte(field))
+	if err != nil {
+		return "", false, fmt.Errorf("error decrypting %s with key %s: %v", field, id, err)
+	}
+	return string(opened), id != r.current, nil
+}
+
+// secretFields returns the sensitive fields of the user config by their JSON names.
+func (c *UserConfig) secretFields() map[string]*string {
+	return map[string]*string{
+		"password":        &c.Password,
+		"access_token":    &c.AccessToken,
+		"refresh_token":   &c.RefreshToken,
+		"caldav_password": &c.CalDAVPassword,
+	}
+}
+
+// encryptSecrets encrypts the sensitive fields of the config in place.
+func (c *UserConfig) encryptSecrets() error {
+	return encryptFields(c.secretFields())
+}
+
+// decryptSecrets decrypts the sensitive fields of the config in place. It reports whether any field
+// needs encrypting again with the current key.
+func (c *UserConfig) decryptSecrets() (stale bool, err error) {
+	return decryptFields(c.secretFields())
+}
+
+// secretFields returns the sensitive fields of the common config by their JSON names.
+func (c *CommonConfig) secretFields() map[string]*string {
+	return map[string]*string{
+		"smtp_password":         &c.SMTPPassword,
+		"availability_password": &c.AvailabilityPassword,
+	}
+}
+
+// decryptSecrets decrypts the sensitive fields of the common config in place. It reports whether
+// any field needs encrypting again with the current key.
+func (c *CommonConfig) decryptSecrets() (stale bool, err error) {
+	return decryptFields(c.secretFields())
+}
+
+// EncryptCommonSecret encrypts a value for the secret field of the common config, e.g.
+// "availability_password", with the current key. The common config is edited by hand, so the
+// result is pasted into it rather than the file being rewritten.
+func EncryptCommonSecret(field, value string) (string, error) {
+	if _, ok := (&CommonConfig{}).secretFields()[field]; !ok {
+		return "", fmt.Errorf("%s is not a secret field of the common config", field)
+	}
+	ring, err := loadedKeyRing()
+	if err != nil {
+		return "", err
+	}
+	if ring.current == "" {
+		return "", fmt.Errorf("no encryption key set in %s or the key file", SecretKeysEnv)
+	}
+	return ring.encrypt(field, value)
+}
+
+// encryptFields encrypts the fields in place with the current key.
+func encryptFields(fields map[string]*string) error {
+	ring, err := loadedKeyRing()
+	if err != nil {
+		return err
+	}
+	for field, value := range fields {
+		if *value, err = ring.encrypt(field, *value); err != nil {
+			return fmt.Errorf("error encrypting %s: %v", field, err)
+		}
+	}
+	return nil
+}
+
+// decryptFields decrypts the fields in place. It reports whether any field needs encrypting again
+// with the current key.
+func decryptFields(fields map[string]*string) (stale bool, err error) {
+	ring, err := loadedKeyRing()
+	if err != nil {
+		return false, err
+	}
+	for field, value := range fields {
+		plaintext, fieldStale, err := ring.decrypt(field, *value)
+		if err != nil {
+			return false, err
+		}
+		*value = plaintext
+		stale = stale || fieldStale
+	}
+	return stale, nil
+}
@@ -0,0 +1,69 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+const syncStateDir = "config/sync_state"
+
+// LoadSyncState reads the user's saved calendar sync state into state. It reports false if no
+// state has been saved yet.
+func LoadSyncState(username string, state interface{}) (bool, error) {
+	return loadUserFile(syncStateDir, username, state)
+}
+
+// SaveSyncState saves the user's calendar sync state, replacing any previous state.
+func SaveSyncState(username string, state interface{}) error {
+	return saveUserFile(syncStateDir, username, state)
+}
+
+// loadUserFile decodes the user's JSON file in dir into v.
+func loadUserFile(dir, username string, v interface{}) (bool, error) {
+	filename, err := userFilePath(dir, username, ".json")
+	if err != nil {
+		return false, err
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	data, err := os.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return false, fmt.Errorf("error parsing %s for %s: %v", dir, username, err)
+	}
+	return true, nil
+}
+
+// saveUserFile atomically replaces the user's JSON file in dir with v, readable only by the owner.
+func saveUserFile(dir, username string, v interface{}) error {
+	filename, err := userFilePath(dir, username, ".json")
+	if err != nil {
+		return err
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create directory %s: %v", dir, err)
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("error encoding %s for %s: %v", dir, username, err)
+	}
+
+	tmpFile := filename + ".tmp"
+	if err := os.WriteFile(tmpFile, data, 0600); err != nil {
+		return fmt.Errorf("failed to write %s: %v", filename, err)
+	}
+	return os.Rename(tmpFile, filename)
+}
@@ -0,0 +1,293 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// ErrUserNotFound is returned by a UserStore for a user it has no config for.
+var ErrUserNotFound = errors.New("user not found")
+
+// UserStore keeps the users' configurations, under the name each user logs in to the site with. The
+// daemon and the web server share it, so changes made by one are seen by the other.
+type UserStore interface {
+	// Get returns the user's config, or ErrUserNotFound.
+	Get(username string) (*UserConfig, error)
+	// List returns the names of all users, in order.
+	List() ([]string, error)
+	// Put saves the user's config, replacing any saved before.
+	Put(username string, cfg *UserConfig) error
+	// Update changes the user's saved config with update and saves it, so changes made at the same
+	// time by the daemon and the web server are not lost. It returns the updated config.
+	Update(username string, update func(*UserConfig) error) (*UserConfig, error)
+	// Delete removes the user's config. Deleting a user that does not exist is not an error.
+	Delete(username string) error
+	// Watch returns a channel that receives a value after users are added, changed or deleted, by
+	// any process. It is closed when ctx is done.
+	Watch(ctx context.Context) <-chan struct{}
+}
+
+// DefaultUserConfigDir is where the JSON user store keeps its files.
+const DefaultUserConfigDir = "config/user_configs"
+
+// ReencryptIfStale saves the config a store just loaded for the user again when stale reports that
+// its secrets were stored in plaintext or with an old key, so they are encrypted with the current
+// key. It returns the config as saved.
+func ReencryptIfStale(users UserStore, username string, config *UserConfig, stale bool) (*UserConfig, error) {
+	if !stale {
+		return config, nil
+	}
+	saved, err := users.Update(username, func(*UserConfig) error { return nil })
+	if err != nil {
+		return nil, fmt.Errorf("error re-encrypting user config for %s: %v", username, err)
+	}
+	return saved, nil
+}
+
+// WatchInterval is how often user stores check for changes made by other processes.
+const WatchInterval = 2 * time.Second
+
+// JSONDirStore keeps each user's config in a JSON file named after them in Dir.
+type JSONDirStore struct {
+	Dir string
+}
+
+// NewJSONDirStore creates a user store keeping its files in dir.
+func NewJSONDirStore(dir string) *JSONDirStore {
+	return &JSONDirStore{Dir: dir}
+}
+
+// Get loads the user's config, encrypting its secrets again if needed.
+func (s *JSONDirStore) Get(username string) (*UserConfig, error) {
+	filename, err := s.path(username)
+	if err != nil {
+		return nil, err
+	}
+	config, stale, err := readUserConfig(filename)
+	if err != nil {
+		return nil, err
+	}
+	return ReencryptIfStale(s, username, config, stale)
+}
+
+// List returns the names of the users with a file in the directory.
+func (s *JSONDirStore) List() ([]string, error) {
+	files, err := filepath.Glob(filepath.Join(s.Dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	usernames := make([]string, 0, len(files))
+	for _, file := range files {
+		usernames = append(usernames, strings.TrimSuffix(filepath.Base(file), ".json"))
+	}
+	return usernames, nil
+}
+
+// Put atomically saves the user's config to their file.
+func (s *JSONDirStore) Put(username string, config *UserConfig) error {
+	filename, err := s.path(username)
+	if err != nil {
+		return err
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if err := os.MkdirAll(s.Dir, 0755); err != nil {
+		return fmt.Errorf("failed to create directory %s: %v", s.Dir, err)
+	}
+	unlock, err := lockFile(filename)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	return writeUserConfig(filename, config)
+}
+
+// Update reads, updates and rewrites the user's file while holding its lock.
+func (s *JSONDirStore) Update(username string, update func(*UserConfig) error) (*UserConfig, error) {
+	filename, err := s.path(username)
+	if err != nil {
+		return nil, err
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	unlock, err := lockFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	config, _, err := readUserConfig(filename)
+	if err != nil {
+		return nil, err
+	}
+	if err := update(config); err != nil {
+		return nil, err
+	}
+	if err := writeUserConfig(filename, config); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// Delete removes the user's file.
+func (s *JSONDirStore) Delete(username string) error {
+	filename, err := s.path(username)
+	if err != nil {
+		return err
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	unlock, err := lockFile(filename)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if err := os.Remove(filename); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to delete user config for %s: %v", username, err)
+	}
+	return nil
+}
+
+// Watch polls the directory for files that were added, removed or rewritten.
+func (s *JSONDirStore) Watch(ctx context.Context) <-chan struct{} {
+	return PollForChanges(ctx, WatchInterval, func() (string, error) {
+		files, err := filepath.Glob(filepath.Join(s.Dir, "*.json"))
+		if err != nil {
+			return "", err
+		}
+
+		var fingerprint strings.Builder
+		for _, file := range files {
+			info, err := os.Stat(file)
+			if os.IsNotExist(err) {
+				continue // Deleted since the glob, the next poll sees it gone
+			}
+			if err != nil {
+				return "", err
+			}
+			fmt.Fprintf(&fingerprint, "%s %d %d\n", file, info.Size(), info.ModTime().UnixNano())
+		}
+		return fingerprint.String(), nil
+	})
+}
+
+// path returns the user's file.
+func (s *JSONDirStore) path(username string) (string, error) {
+	return userFilePath(s.Dir, username, ".json")
+}
+
+// ValidateUsername refuses usernames that cannot name a user's files: empty names, "." and "..",
+// and names with path separators or control characters. Every file named after a user is found
+// through userFilePath, which checks the name, and user stores refuse to save users with such names.
+func ValidateUsername(username string) error {
+	if username == "" || username == "." || username == ".." || strings.ContainsAny(username, `/\`) ||
+		strings.IndexFunc(username, unicode.IsControl) >= 0 {
+		return fmt.Errorf("invalid username %q", username)
+	}
+	return nil
+}
+
+// userFilePath returns the file named after the user with the given extension in dir.
+func userFilePath(dir, username, ext string) (string, error) {
+	if err := ValidateUsername(username); err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, username+ext), nil
+}
+
+// readUserConfig reads the user config file and decrypts its secrets. It reports whether the secrets
+// need encrypting again with the current key.
+func readUserConfig(filename string) (*UserConfig, bool, error) {
+	data, err := os.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return nil, false, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	config, stale, err := DecodeUserConfig(data)
+	if err != nil {
+		return nil, false, fmt.Errorf("%s: %v", filename, err)
+	}
+	return config, stale, nil
+}
+
+// writeUserConfig atomically replaces the user config file with the config, encrypting its secrets.
+// Only the owner can read the file. The caller must hold mu and the file's lock.
+func writeUserConfig(filename string, config *UserConfig) error {
+	data, err := EncodeUserConfig(config)
+	if err != nil {
+		return err
+	}
+
+	// Write to a temporary file to avoid incomplete writes
+	tmpFilePath := filename + ".tmp"
+	if err := os.WriteFile(tmpFilePath, data, 0600); err != nil {
+		return fmt.Errorf("failed to write temp config file for %s: %v", config.Username, err)
+	}
+
+	// Rename the temp file to the final file path
+	if err := os.Rename(tmpFilePath, filename); err != nil {
+		return fmt.Errorf("failed to rename temp config file for %s: %v", config.Username, err)
+	}
+
+	return nil
+}
+
+// PollForChanges calls fingerprint every interval and sends on the returned channel when its result
+// changes, for stores that other processes change without telling this one. Changes are coalesced
+// while the receiver is busy. The channel is closed when ctx is done.
+func PollForChanges(ctx context.Context, interval time.Duration, fingerprint func() (string, error)) <-chan struct{} {
+	// Changes made once Watch returns are seen, as the first fingerprint is taken before
+	last, err := fingerprint()
+	if err != nil {
+		log.Printf("Error checking user store for changes: %v", err)
+	}
+
+	changes := make(chan struct{}, 1)
+	go func() {
+		defer close(changes)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			current, err := fingerprint()
+			if err != nil {
+				log.Printf("Error checking user store for changes: %v", err)
+				continue
+			}
+			if current == last {
+				continue
+			}
+			last = current
+			select {
+			case changes <- struct{}{}:
+			default:
+			}
+		}
+	}()
+	return changes
+}
@@ -0,0 +1,72 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestValidateUsername(t *testing.T) {
+	tests := []struct {
+		username string
+		valid    bool
+	}{
+		{"alice", true},
+		{"alice.smith@example.com", true},
+		{"", false},
+		{".", false},
+		{"..", false},
+		{"../alice", false},
+		{`..\alice`, false},
+		{"alice/bob", false},
+		{"alice\x00", false},
+		{"alice\n", false},
+	}
+
+	for _, tt := range tests {
+		err := ValidateUsername(tt.username)
+		if (err == nil) != tt.valid {
+			t.Errorf("ValidateUsername(%q) = %v, want valid %v", tt.username, err, tt.valid)
+		}
+	}
+}
+
+func TestUserFilesStayInTheirDirectory(t *testing.T) {
+	dir := t.TempDir()
+	users := NewJSONDirStore(filepath.Join(dir, "users"))
+
+	if err := users.Put("../escaped", &UserConfig{Username: "escaped"}); err == nil {
+		t.Errorf("Put saved a user named ../escaped")
+	}
+	if err := saveUserFile(filepath.Join(dir, "state"), "../escaped", struct{}{}); err == nil {
+		t.Errorf("saveUserFile saved a file for ../escaped")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "escaped.json")); !os.IsNotExist(err) {
+		t.Errorf("file written outside its directory: %v", err)
+	}
+}
+
+func TestUserFilesAreOwnerOnly(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("file modes are not enforced on Windows")
+	}
+	dir := t.TempDir()
+	users := NewJSONDirStore(filepath.Join(dir, "users"))
+	if err := users.Put("alice", &UserConfig{Username: "alice", Password: "secret"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := saveUserFile(filepath.Join(dir, "state"), "alice", struct{}{}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, filename := range []string{filepath.Join(dir, "users", "alice.json"), filepath.Join(dir, "state", "alice.json")} {
+		info, err := os.Stat(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if mode := info.Mode().Perm(); mode != 0600 {
+			t.Errorf("%s has mode %o, want 0600", filename, mode)
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"funtech-scraper/config"
+	"funtech-scraper/store"
+)
+
+const adminUsage = `Usage: funtech-admin <command> [flags]
+
+Commands:
+  sessions [-user name]                 List active web sessions
+  revoke-sessions (-user name | -all)   Log users out of the web server
+  import-users [-dir path] [-replace]   Copy the JSON user configs into the database
+  rotate-keys                           Re-encrypt every user's secrets with the current key
+  encrypt-secret [-field name]          Encrypt a password read from stdin for common_config.json
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, adminUsage)
+		os.Exit(2)
+	}
+
+	dataStore, err := store.Open(store.DefaultPath)
+	if err != nil {
+		log.Fatalf("Error opening store: %v", err)
+	}
+	defer dataStore.Close()
+
+	command, args := os.Args[1], os.Args[2:]
+	switch command {
+	case "sessions":
+		listSessions(dataStore, args)
+	case "revoke-sessions":
+		revokeSessions(dataStore, args)
+	case "import-users":
+		importUsers(dataStore, args)
+	case "rotate-keys":
+		rotateKeys(dataStore, args)
+	case "encrypt-secret":
+		encryptSecret(args)
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown command %q\n\n%s", command, adminUsage)
+		os.Exit(2)
+	}
+}
+
+// listSessions prints the active sessions of one user or of everyone.
+func listSessions(dataStore *store.Store, args []string) {
+	flags := flag.NewFlagSet("sessions", flag.ExitOnError)
+	user := flags.String("user", "", "Only list this user's sessions")
+	flags.Parse(args)
+
+	sessions, err := dataStore.Sessions(*user)
+	if err != nil {
+		log.Fatalf("Error listing sessions: %v", err)
+	}
+	for _, session := range sessions {
+		fmt.Printf("%-20s created %s, expires %s\n", session.Username,
+			session.CreatedAt.Local().Format("02/01/2006 15:04"), session.ExpiresAt.Local().Format("02/01/2006 15:04"))
+	}
+	fmt.Printf("%d active sessions\n", len(sessions))
+}
+
+// revokeSessions logs a user, or everyone, out of the web server.
+func revokeSessions(dataStore *store.Store, args []string) {
+	flags := flag.NewFlagSet("revoke-sessions", flag.ExitOnError)
+	user := flags.String("user", "", "Revoke this user's sessions")
+	all := flags.Bool("all", false, "Revoke every user's sessions")
+	flags.Parse(args)
+
+	if (*user == "") != *all {
+		log.Fatalf("Give either -user or -all")
+	}
+	revoked, err := dataStore.DeleteUserSessions(*user)
+	if err != nil {
+		log.Fatalf("Error revoking sessions: %v", err)
+	}
+	fmt.Printf("Revoked %d sessions\n", revoked)
+}
+
+// importUsers copies the user configs from the JSON files into the database, for switching
+// "user_store" to "sqlite". Users already in the database are kept unless -replace is given.
+func importUsers(dataStore *store.Store, args []string) {
+	flags := flag.NewFlagSet("import-users", flag.ExitOnError)
+	dir := flags.String("dir", config.DefaultUserConfigDir, "Directory of the JSON user configs")
+	replace := flags.Bool("replace", false, "Overwrite users already in the database")
+	flags.Parse(args)
+
+	files := config.NewJSONDirStore(*dir)
+	users := dataStore.Users()
+	usernames, err := files.List()
+	if err != nil {
+		log.Fatalf("Error listing user configs in %s: %v", *dir, err)
+	}
+
+	imported := 0
+	for _, username := range usernames {
+		userCfg, err := files.Get(username)
+		if err != nil {
+			log.Fatalf("Error loading user config (%s): %v", username, err)
+		}
+		if !*replace {
+			if _, err := users.Get(username); err == nil {
+				fmt.Printf("Skipping %s, already in the database\n", username)
+				continue
+			} else if !errors.Is(err, config.ErrUserNotFound) {
+				log.Fatalf("Error reading user %s from the database: %v", username, err)
+			}
+		}
+		if err := users.Put(username, userCfg); err != nil {
+			log.Fatalf("Error importing user %s: %v", username, err)
+		}
+		imported++
+	}
+	fmt.Printf("Imported %d of %d users\n", imported, len(usernames))
+}
+
+// rotateKeys rewrites every user in the configured user store, so secrets stored as plaintext or
+// with an old key are encrypted with the current key and the old key can be removed.
+func rotateKeys(dataStore *store.Store, args []string) {
+	flags := flag.NewFlagSet("rotate-keys", flag.ExitOnError)
+	flags.Parse(args)
+
+	keyID, err := config.CurrentSecretKey()
+	if err != nil {
+		log.Fatalf("Error loading encryption keys: %v", err)
+	}
+	if keyID == "" {
+		log.Fatalf("No encryption key set in %s or the key file, refusing to store secrets as plaintext", config.SecretKeysEnv)
+	}
+
+	commonCfg, err := config.LoadCommonConfig("config/common_config.json")
+	if err != nil {
+		log.Fatalf("Error loading common config: %v", err)
+	}
+	users, err := store.OpenUserStore(commonCfg, dataStore)
+	if err != nil {
+		log.Fatalf("Error opening user store: %v", err)
+	}
+	usernames, err := users.List()
+	if err != nil {
+		log.Fatalf("Error listing users: %v", err)
+	}
+
+	for _, username := range usernames {
+		if _, err := users.Update(username, func(*config.UserConfig) error { return nil }); err != nil {
+			log.Fatalf("Error re-encrypting user %s: %v", username, err)
+		}
+	}
+	fmt.Printf("Re-encrypted %d users with key %s\n", len(usernames), keyID)
+}
+
+// encryptSecret prints a password read from stdin encrypted with the current key, to be pasted
+// into a secret field of common_config.json.
+func encryptSecret(args []string) {
+	flags := flag.NewFlagSet("encrypt-secret", flag.ExitOnError)
+	field := flags.String("field", "availability_password", "Field of the common config the password is for")
+	flags.Parse(args)
+
+	fmt.Fprintf(os.Stderr, "Enter the value of %s: ", *field)
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		log.Fatalf("Error reading the value: %v", err)
+	}
+	encrypted, err := config.EncryptCommonSecret(*field, strings.TrimRight(line, "\r\n"))
+	if err != nil {
+		log.Fatalf("Error encrypting %s: %v", *field, err)
+	}
+	fmt.Printf("\"%s\": \"%s\"\n", *field, encrypted)
+}
@@ -1,21 +1,31 @@
 package main
 
 import (
+	"errors"
+	"flag"
 	"fmt"
 	"log"
-	"path/filepath"
 	"time"
 
 	"funtech-scraper/config"
+	"funtech-scraper/notify"
 	"funtech-scraper/scraper"
-
-	"github.com/playwright-community/playwright-go"
+	"funtech-scraper/store"
 )
 
-const availabilityCheckInterval = 24 * time.Hour // Interval for checking availability
+const availabilityCheckInterval = 24 * time.Hour // How long scraped availability is reused
+const availabilityRetryInterval = time.Hour      // How long an account is not scraped again after failing
 const maxAvailabilityRetries = 3                 // Maximum retries for availability scraping
+const defaultMaxDeleteFraction = 0.5             // Largest share of synced events a sync may delete by default
+
+// serviceAccountKey is the cache key of the availability scraped with the service account. The
+// cache is otherwise keyed by username, and usernames cannot contain a slash, so no user shares it.
+const serviceAccountKey = "/service account"
 
 func main() {
+	dryRun := flag.Bool("dry-run", false, "Print the calendar changes each user's sync would make, without making them, then exit")
+	flag.Parse()
+
 	clearAll := false // Set this to true if you want to clear the calendar first
 
 	// Load common configuration
@@ -24,120 +34,217 @@ func main() {
 		log.Fatalf("Error loading common config: %v", err)
 	}
 
-	// Variables to store shared availability data
-	var sharedWeeksByTerm map[string][]scraper.Week
-	var sharedYear string
-	lastAvailabilityRun := time.Time{} // Track the last time availability was run
+	// Open the lesson store shared with the web server
+	lessonStore, err := store.Open(store.DefaultPath)
+	if err != nil {
+		log.Fatalf("Error opening lesson store: %v", err)
+	}
+	defer lessonStore.Close()
+
+	// Availability is scraped for each user, or with the service account, once a day, and an
+	// account that failed is left for an hour rather than retried for every user on every loop
+	availabilityCache := scraper.NewAvailabilityCache(availabilityCheckInterval, availabilityRetryInterval)
 
-	// Initialize Playwright
-	pw, err := playwright.Run()
+	// Set up the portal client (shared across all users)
+	client, closeClient, err := scraper.NewPortalClient(commonCfg)
 	if err != nil {
-		log.Fatalf("Couldn't start Playwright: %v", err)
+		log.Fatalf("Could not set up portal client: %v", err)
 	}
-	defer pw.Stop()
+	defer closeClient()
 
-	// Set up the browser (shared across all users)
-	browser, err := pw.Chromium.Launch(playwright.BrowserTypeLaunchOptions{
-		Headless: playwright.Bool(true), // Set to false if you want to see the browser in action
-	})
+	// Users are read from the store chosen in the common config, shared with the web server
+	userStore, err := store.OpenUserStore(commonCfg, lessonStore)
 	if err != nil {
-		log.Fatalf("Could not launch browser: %v", err)
+		log.Fatalf("Error opening user store: %v", err)
 	}
-	defer browser.Close()
 
 	for {
-		// Get the list of user config files
-		userConfigFiles, err := filepath.Glob("config/user_configs/*.json")
+		// Get the list of users
+		usernames, err := userStore.List()
 		if err != nil {
-			log.Fatalf("Error reading user config files: %v", err)
+			log.Fatalf("Error listing users: %v", err)
 		}
 
-		// Run ScrapeAvailability once for all users, if needed (e.g., every 24 hours)
-		if sharedWeeksByTerm == nil || sharedYear == "" || time.Since(lastAvailabilityRun) >= availabilityCheckInterval {
-			fmt.Println("Running ScrapeAvailability to fetch availability data for all users...")
+		if len(usernames) == 0 {
+			fmt.Println("No user configurations found. Nothing to scrape.")
+		}
 
-			// Retry logic for ScrapeAvailability
-			for retry := 0; retry < maxAvailabilityRetries; retry++ {
-				if len(userConfigFiles) > 0 {
-					userCfg, err := config.LoadUserConfig(userConfigFiles[0])
-					if err != nil {
-						log.Fatalf("Error loading user config for scraping availability: %v", err)
-					}
+		// Run ScrapeLessons for each user individually
+		for _, username := range usernames {
+			// Load user configuration
+			userCfg, err := userStore.Get(username)
+			if err != nil {
+				fmt.Printf("Error loading user config (%s): %v\n", username, err)
+				continue
+			}
 
-					// Scrape availability data using Playwright
-					_, weeksByTerm, year := scraper.ScrapeAvailabilityWithClient(browser, userCfg.Username, userCfg.Password)
-
-					if weeksByTerm != nil && year != "" {
-						sharedWeeksByTerm = weeksByTerm
-						sharedYear = year
-						lastAvailabilityRun = time.Now()
-						fmt.Println("ScrapeAvailability completed. Data shared across all users.")
-						break
-					} else {
-						fmt.Printf("Availability scraping failed on attempt %d. Retrying...\n", retry+1)
-					}
+			// Ensure we have availability data before proceeding
+			availability, ok := availabilityFor(client, availabilityCache, commonCfg, username, userCfg)
+			if !ok {
+				fmt.Printf("No availability data for user (%s). Skipping lesson scraping.\n", userCfg.Username)
+				continue
+			}
 
-				} else {
-					fmt.Println("No user configurations found. Cannot scrape availability.")
-					return
+			// Run the scraper to get lessons for the current user
+			var allResults []scraper.ScrapeResult
+			var scrapeErr error
+			for _, weeks := range availability.WeeksByTerm {
+				// Using the shared portal client for scraping lessons
+				results, err := scraper.ScrapeLessonsWithClient(client, userCfg.Username, userCfg.Password, weeks, availability.Year)
+				if err != nil {
+					scrapeErr = err
+					break
 				}
-				// Wait before retrying if the last attempt failed
-				time.Sleep(5 * time.Second)
+				allResults = append(allResults, results...)
 			}
+			logScrapeResults(userCfg.Username, allResults)
 
-			// If after retries, still no availability data
-			if sharedWeeksByTerm == nil || sharedYear == "" {
-				fmt.Println("ScrapeAvailability failed after all retries. Sleeping.")
-				time.Sleep(10 * time.Minute)
+			// Never sync when login failed, as it would delete every lesson. Weeks that failed
+			// to scrape are left alone by the sync itself.
+			if scrapeErr != nil {
+				fmt.Printf("Sync blocked for user (%s): %v\n", userCfg.Username, scrapeErr)
+				recordSyncRun(lessonStore, username, store.SyncRun{Status: store.SyncRunBlocked, Reason: "scrape failed: " + scrapeErr.Error()})
+				continue
 			}
-		}
 
-		// Run ScrapeLessons for each user individually, using the shared availability data
-		for _, userConfigFile := range userConfigFiles {
-			// Load user configuration
-			userCfg, err := config.LoadUserConfig(userConfigFile)
-			if err != nil {
-				fmt.Printf("Error loading user config (%s): %v\n", userConfigFile, err)
+			// Refuse scrapes and syncs that delete too many lessons or events unless the user
+			// approved them from the dashboard
+			maxDeleteFraction := commonCfg.MaxDeleteFraction
+			if maxDeleteFraction == 0 {
+				maxDeleteFraction = defaultMaxDeleteFraction
+			}
+			if userCfg.ApproveNextSync {
+				maxDeleteFraction = 0
+			}
+
+			// Keep the lessons for the web server and the user's calendar feed
+			// and tell the user about lessons that changed since the last scrape
+			if !*dryRun {
+				removed, listed, err := lessonStore.ScrapeRemovals(username, allResults)
+				if err != nil {
+					fmt.Printf("Error checking lessons for user (%s): %v\n", userCfg.Username, err)
+					continue
+				}
+				var blocked *scraper.SyncBlockedError
+				if errors.As(scraper.CheckDeleteFraction(removed, listed, maxDeleteFraction, "stored lessons"), &blocked) {
+					fmt.Printf("Sync blocked for user (%s): %s\n", userCfg.Username, blocked.Reason)
+					recordSyncRun(lessonStore, username, store.SyncRun{Status: store.SyncRunBlocked, Reason: blocked.Reason, Deletes: removed})
+					continue
+				}
+
+				changes, err := lessonStore.RecordScrape(username, allResults)
+				if err != nil {
+					fmt.Printf("Error saving lessons for user (%s): %v\n", userCfg.Username, err)
+				} else if len(changes) > 0 {
+					notifyLessonChanges(commonCfg, userCfg, changes)
+				}
+			}
+			if userCfg.CalendarSink == config.CalendarSinkFeed {
+				// Without a calendar sync to clear it, the approval is used up by this scrape
+				if userCfg.ApproveNextSync && !*dryRun {
+					clearSyncApproval(userStore, username)
+				}
 				continue
 			}
 
-			// Ensure we have shared availability data before proceeding
-			if sharedWeeksByTerm == nil || sharedYear == "" {
-				fmt.Println("No availability data available. Skipping lesson scraping.")
+			syncOpts := scraper.SyncOptions{
+				ClearAll:          clearAll,
+				DryRun:            *dryRun,
+				MaxDeleteFraction: maxDeleteFraction,
+				AdoptUntagged:     userCfg.AdoptUntagged,
+			}
+
+			// Google rejected the user's token on an earlier pass, so wait for them to reconnect
+			// on the dashboard rather than failing every loop
+			if userCfg.NeedsReauth && (userCfg.CalendarSink == "" || userCfg.CalendarSink == "google") {
+				fmt.Printf("Skipping sync for user (%s): waiting for them to reconnect Google Calendar\n", userCfg.Username)
 				continue
 			}
 
-			// Run the scraper to get lessons for the current user
-			var allLessons []scraper.Lesson
-			for _, weeks := range sharedWeeksByTerm {
-				// Using the shared browser for scraping lessons
-				lessons := scraper.ScrapeLessonsWithClient(browser, userCfg.Username, userCfg.Password, weeks, sharedYear)
-				allLessons = append(allLessons, lessons...)
+			// Reuse the events fetched by the last sync so only changed events are listed
+			syncState := &scraper.SyncState{}
+			if _, err := config.LoadSyncState(username, syncState); err != nil {
+				fmt.Printf("Error loading sync state for user (%s), listing all events: %v\n", userCfg.Username, err)
+				syncState = &scraper.SyncState{}
+			}
+
+			// Google rejecting the user's token is not retried: their syncs are skipped until they reconnect
+			reauthNeeded := func(err error) bool {
+				var authErr *scraper.GoogleAuthError
+				if !errors.As(err, &authErr) {
+					return false
+				}
+				fmt.Printf("Google authorization needed for user (%s), skipping syncs until they reconnect: %s\n", userCfg.Username, authErr.Reason)
+				if !*dryRun {
+					markNeedsReauth(userStore, username)
+					recordSyncRun(lessonStore, username, store.SyncRun{Status: store.SyncRunFailed, Reason: authErr.Error()})
+				}
+				return true
 			}
 
-			// Sync with Google Calendar
-			// Retry logic for getting the Google Calendar service
+			// Sync with the user's calendar
+			// Retry logic for setting up the calendar sink
 			maxRetries := 3
 			for retries := 0; retries < maxRetries; retries++ {
-				service, err := scraper.GetCalendarService(commonCfg, userCfg, config.GetAuthCode, config.SaveUserConfig)
+				sink, err := scraper.NewCalendarSink(commonCfg, userStore, username, userCfg, syncState)
+				if reauthNeeded(err) {
+					break
+				}
 				if err != nil {
-					fmt.Printf("Error getting Google Calendar service for user (%s), attempt %d: %v\n", userCfg.Username, retries+1, err)
-					time.Sleep(5 * time.Second)
+					fmt.Printf("Error setting up calendar for user (%s), attempt %d: %v\n", userCfg.Username, retries+1, err)
+					time.Sleep(scraper.RetryDelay(err, retries+1))
 					continue
 				}
 
-				err = scraper.AddLessonsToGoogleCalendar(service, userCfg.GoogleCalendarID, allLessons, clearAll)
+				plan, err := scraper.SyncLessons(sink, allResults, syncOpts)
+				if syncState.SyncToken != "" {
+					if err := config.SaveSyncState(username, syncState); err != nil {
+						fmt.Printf("Error saving sync state for user (%s): %v\n", userCfg.Username, err)
+					}
+				}
+				if reauthNeeded(err) {
+					break
+				}
+				var blocked *scraper.SyncBlockedError
+				if errors.As(err, &blocked) {
+					fmt.Printf("Sync blocked for user (%s): %s\n", userCfg.Username, blocked.Reason)
+					if !*dryRun {
+						recordSyncRun(lessonStore, username, store.SyncRun{Status: store.SyncRunBlocked, Reason: blocked.Reason, Deletes: len(plan.Deletes)})
+					}
+					break
+				}
 				if err != nil {
-					fmt.Printf("Error syncing lessons with Google Calendar for user (%s), attempt %d: %v\n", userCfg.Username, retries+1, err)
-					time.Sleep(5 * time.Second)
+					fmt.Printf("Error syncing lessons with calendar for user (%s), attempt %d: %v\n", userCfg.Username, retries+1, err)
+					if retries == maxRetries-1 && !*dryRun {
+						recordSyncRun(lessonStore, username, store.SyncRun{Status: store.SyncRunFailed, Reason: err.Error()})
+					}
+					time.Sleep(scraper.RetryDelay(err, retries+1))
 					continue
 				}
 
-				fmt.Printf("Lessons successfully synced with Google Calendar for user: %s on attempt %d\n", userCfg.Username, retries+1)
+				if *dryRun {
+					fmt.Printf("Planned changes for user %s:\n%s", userCfg.Username, plan)
+					break
+				}
+
+				recordSyncRun(lessonStore, username, store.SyncRun{Status: store.SyncRunOK, Inserts: len(plan.Inserts), Updates: len(plan.Updates), Deletes: len(plan.Deletes)})
+				if plan.Adoptable > 0 {
+					fmt.Printf("Left %d events matching lessons alone for user (%s) until they agree to adopt them\n", plan.Adoptable, userCfg.Username)
+				}
+				if userCfg.ApproveNextSync || userCfg.AdoptUntagged {
+					clearSyncApproval(userStore, username)
+				}
+
+				fmt.Printf("Lessons successfully synced with calendar for user: %s on attempt %d\n", userCfg.Username, retries+1)
 				break
 			}
 		}
 
+		// A dry run only plans a single pass
+		if *dryRun {
+			return
+		}
+
 		// Wait before the next iteration
 		if !clearAll {
 			time.Sleep(10 * time.Minute)
@@ -145,3 +252,115 @@ func main() {
 		clearAll = false
 	}
 }
+
+// availabilityFor returns the terms and weeks to scrape the user's lessons in. They are scraped with
+// the service account from the common config if there is one, else with the user's own login, and
+// reused for a day. If scraping fails, the user's older availability, or another user's, is used.
+func availabilityFor(client scraper.PortalClient, cache *scraper.AvailabilityCache, commonCfg *config.CommonConfig, username string, userCfg *config.UserConfig) (*scraper.Availability, bool) {
+	if commonCfg.AvailabilityUsername != "" {
+		if availability, ok := scrapeAvailability(client, cache, serviceAccountKey, commonCfg.AvailabilityUsername, commonCfg.AvailabilityPassword); ok {
+			return availability, true
+		}
+	}
+	if availability, ok := scrapeAvailability(client, cache, username, userCfg.Username, userCfg.Password); ok {
+		return availability, true
+	}
+
+	availability, key, ok := cache.Fallback(username)
+	if ok {
+		fmt.Printf("Using the availability scraped for %s on %s for user (%s)\n", key, availability.FetchedAt.Format("02/01/2006 15:04"), userCfg.Username)
+	}
+	return availability, ok
+}
+
+// scrapeAvailability returns the availability cached under key if it is fresh, or else scrapes it by
+// logging in to the portal with the given account and caches it. After every attempt fails, the
+// account is not scraped again until the cache's RetryAfter has passed.
+func scrapeAvailability(client scraper.PortalClient, cache *scraper.AvailabilityCache, key, portalUsername, portalPassword string) (*scraper.Availability, bool) {
+	if availability, ok := cache.Fresh(key); ok {
+		return availability, true
+	}
+	if cache.Failed(key) {
+		return nil, false
+	}
+
+	fmt.Printf("Running ScrapeAvailability for %s...\n", key)
+	for retry := 0; retry < maxAvailabilityRetries; retry++ {
+		_, weeksByTerm, year := scraper.ScrapeAvailabilityWithClient(client, portalUsername, portalPassword)
+		if weeksByTerm != nil && year != "" {
+			availability := &scraper.Availability{Year: year, WeeksByTerm: weeksByTerm, FetchedAt: time.Now()}
+			cache.Put(key, availability)
+			fmt.Printf("ScrapeAvailability completed for %s.\n", key)
+			return availability, true
+		}
+
+		fmt.Printf("Availability scraping for %s failed on attempt %d.\n", key, retry+1)
+		// Wait before retrying if the last attempt failed
+		if retry < maxAvailabilityRetries-1 {
+			time.Sleep(5 * time.Second)
+		}
+	}
+	cache.PutFailure(key)
+	fmt.Printf("Not scraping availability for %s again for %s.\n", key, cache.RetryAfter)
+	return nil, false
+}
+
+// notifyLessonChanges logs the changes to a user's lessons and sends them through the user's notifiers.
+func notifyLessonChanges(commonCfg *config.CommonConfig, userCfg *config.UserConfig, changes []scraper.LessonChange) {
+	for _, change := range changes {
+		fmt.Printf("Lesson change for user (%s): %s\n", userCfg.Username, change)
+	}
+
+	notifier := notify.ForUser(commonCfg, userCfg)
+	if notifier == nil {
+		return
+	}
+	if err := notifier.Notify(userCfg.Username, changes); err != nil {
+		fmt.Printf("Error notifying user (%s) of lesson changes: %v\n", userCfg.Username, err)
+	}
+}
+
+// markNeedsReauth saves that the user must authorise Google Calendar again, so the dashboard asks
+// them to and syncs are skipped until they do.
+func markNeedsReauth(userStore config.UserStore, username string) {
+	_, err := userStore.Update(username, func(userCfg *config.UserConfig) error {
+		userCfg.NeedsReauth = true
+		return nil
+	})
+	if err != nil {
+		fmt.Printf("Error saving that user (%s) needs Google authorization: %v\n", username, err)
+	}
+}
+
+// clearSyncApproval clears the user's one-off approvals once a sync has used them.
+func clearSyncApproval(userStore config.UserStore, username string) {
+	_, err := userStore.Update(username, func(userCfg *config.UserConfig) error {
+		userCfg.ApproveNextSync = false
+		userCfg.AdoptUntagged = false
+		return nil
+	})
+	if err != nil {
+		fmt.Printf("Error clearing sync approval for user (%s): %v\n", username, err)
+	}
+}
+
+// recordSyncRun records the outcome of a user's sync, logging any failure to do so.
+func recordSyncRun(lessonStore *store.Store, username string, run store.SyncRun) {
+	run.Time = time.Now()
+	if err := lessonStore.RecordSyncRun(username, run); err != nil {
+		fmt.Printf("Error recording sync run for user (%s): %v\n", username, err)
+	}
+}
+
+// logScrapeResults logs how many weeks were scraped for a user and which ones failed.
+func logScrapeResults(username string, results []scraper.ScrapeResult) {
+	counts := map[scraper.ScrapeStatus]int{}
+	for _, result := range results {
+		counts[result.Status]++
+		if result.Status == scraper.ScrapeFailed {
+			fmt.Printf("Week %s failed to scrape for user (%s): %v\n", result.Week.Key(), username, result.Err)
+		}
+	}
+	fmt.Printf("Scraped %d weeks for user %s: %d ok, %d empty, %d failed\n",
+		len(results), username, counts[scraper.ScrapeOK], counts[scraper.ScrapeEmpty], counts[scraper.ScrapeFailed])
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+
+	"funtech-scraper/scraper/portaltest"
+)
+
+// funtech_mock_portal serves a fake FunTech tutor portal from a scenario file, so the
+// daemon can run offline by setting "portal_base_url" to this server's address.
+func main() {
+	scenarioFile := flag.String("scenario", "config/portal_scenario.json", "Scenario describing the portal's users, terms and lessons")
+	addr := flag.String("addr", "localhost:8200", "Address to listen on")
+	flag.Parse()
+
+	scenario, err := portaltest.LoadScenario(*scenarioFile)
+	if err != nil {
+		log.Fatalf("Error loading portal scenario: %v", err)
+	}
+
+	log.Printf("Starting mock FunTech portal on http://%s\n", *addr)
+	log.Fatal(http.ListenAndServe(*addr, portaltest.NewPortal(scenario)))
+}
@@ -1,12 +1,14 @@
 package main
 
 import (
+	"context"
 	"log"
 	"net/http"
 	"os"
 
 	"funtech-scraper/config"
 	"funtech-scraper/site"
+	"funtech-scraper/store"
 )
 
 func StartServer(httpPort string) {
@@ -19,16 +21,41 @@ func StartServer(httpPort string) {
 
 	// Initialize OAuth configuration
 	site.InitOAuthConfig(commonCfg)
+	if err := site.InitTemplates("site/templates"); err != nil {
+		log.Fatal(err)
+	}
+
+	// Open the store holding login sessions and the lessons the daemon scrapes
+	dataStore, err := store.Open(store.DefaultPath)
+	if err != nil {
+		log.Fatalf("Error opening store: %v", err)
+	}
+	defer dataStore.Close()
+	site.InitStore(dataStore)
 
-	// Load user configurations
-	if err := site.LoadUserConfigs(); err != nil {
+	// Load user configurations from the store chosen in the common config
+	userStore, err := store.OpenUserStore(commonCfg, dataStore)
+	if err != nil {
+		log.Fatalf("Error opening user store: %v", err)
+	}
+	if err := site.LoadUserConfigs(userStore); err != nil {
 		log.Fatalf("Error loading user configs: %v", err)
 	}
+	// Pick up changes the daemon or an admin makes to users while the server runs
+	go site.WatchUserConfigs(context.Background())
 
 	http.HandleFunc("/", site.HomeRedirectHandler)
 	http.HandleFunc("/auth", site.AuthHandler)
 	http.HandleFunc("/dashboard", site.DashboardHandler)
 	http.HandleFunc("/auth_callback", site.AuthCallbackHandler)
+	http.HandleFunc("/google_auth", site.GoogleAuthHandler)
+	http.HandleFunc("/preview", site.PreviewHandler)
+	http.HandleFunc("/approve_sync", site.ApproveSyncHandler)
+	http.HandleFunc("/adopt_events", site.AdoptEventsHandler)
+	http.HandleFunc("/feed/", site.FeedHandler)
+	http.HandleFunc("/rotate_feed_token", site.RotateFeedTokenHandler)
+	http.HandleFunc("/change_password", site.ChangePasswordHandler)
+	http.HandleFunc("/logout", site.LogoutHandler)
 
 	fs := http.FileServer(http.Dir("site/templates"))
 	http.Handle("/site/templates/", http.StripPrefix("/site/templates/", fs))
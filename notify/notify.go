@@ -0,0 +1,71 @@
+// Package notify tells tutors when their lessons are added, cancelled or rescheduled.
+package notify
+
+import (
+	"fmt"
+	"strings"
+
+	"funtech-scraper/config"
+	"funtech-scraper/scraper"
+)
+
+// Notifier sends a user the changes found in their lessons.
+type Notifier interface {
+	Notify(username string, changes []scraper.LessonChange) error
+}
+
+// Multi sends changes through several notifiers.
+type Multi []Notifier
+
+// Notify sends the changes through every notifier, reporting the failed ones together.
+func (m Multi) Notify(username string, changes []scraper.LessonChange) error {
+	var failures []string
+	for _, notifier := range m {
+		if err := notifier.Notify(username, changes); err != nil {
+			failures = append(failures, err.Error())
+		}
+	}
+	if len(failures) > 0 {
+		return fmt.Errorf("%d of %d notifications failed: %s", len(failures), len(m), strings.Join(failures, "; "))
+	}
+	return nil
+}
+
+// ForUser returns the notifiers the user has set up, or nil if they have none. Email needs a mail
+// server in the common config.
+func ForUser(commonCfg *config.CommonConfig, userCfg *config.UserConfig) Notifier {
+	var notifiers Multi
+	if userCfg.NotifyEmail != "" && commonCfg.SMTPHost != "" {
+		notifiers = append(notifiers, NewSMTPNotifier(commonCfg, userCfg.NotifyEmail))
+	}
+	if userCfg.NotifyWebhookURL != "" {
+		notifiers = append(notifiers, NewWebhookNotifier(userCfg.NotifyWebhookURL))
+	}
+
+	switch len(notifiers) {
+	case 0:
+		return nil
+	case 1:
+		return notifiers[0]
+	default:
+		return notifiers
+	}
+}
+
+// Summary lists the changes one per line, for the body of a message.
+func Summary(changes []scraper.LessonChange) string {
+	var sb strings.Builder
+	for _, change := range changes {
+		sb.WriteString(change.String())
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+// subject sums up the changes in a line.
+func subject(changes []scraper.LessonChange) string {
+	if len(changes) == 1 {
+		return changes[0].String()
+	}
+	return fmt.Sprintf("%d changes to your FunTech lessons", len(changes))
+}
@@ -0,0 +1,26 @@
+package notify
+
+import (
+	"time"
+
+	"funtech-scraper/scraper"
+)
+
+// movedLesson returns the change of the Thursday 16:00 Python L2 lesson moving to 17:00.
+func movedLesson() scraper.LessonChange {
+	week := scraper.Week{Year: "2024-25", Term: 1, WeekNumber: 1, StartDate: "23/09/2024"}
+	old := scraper.Lesson{
+		Key:       scraper.LessonKey(week, "Thursday", "Python L2", 0),
+		WeekKey:   week.Key(),
+		Course:    "Python L2",
+		Day:       "Thursday",
+		StartTime: "16:00",
+		EndTime:   "17:00",
+		Date:      time.Date(2024, time.September, 26, 0, 0, 0, 0, time.UTC),
+	}
+	moved := old
+	moved.StartTime, moved.EndTime = "17:00", "18:00"
+	return scraper.LessonChange{Kind: scraper.LessonRescheduled, Key: old.Key, DetectedAt: time.Now(), Old: old, New: moved}
+}
+
+const movedLessonText = "Thursday 26/09 16:00 Python L2 moved to 17:00 and now ends at 18:00"
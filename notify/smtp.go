@@ -0,0 +1,73 @@
+package notify
+
+import (
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+
+	"funtech-scraper/config"
+	"funtech-scraper/scraper"
+)
+
+const defaultSMTPPort = 587
+
+// SMTPNotifier emails the changes through a mail server. The server's STARTTLS is used when it
+// offers it; logging in without TLS is only allowed to a server on localhost.
+type SMTPNotifier struct {
+	Addr     string // host:port of the mail server
+	Username string // Logs in with PLAIN auth when set
+	Password string
+	From     string
+	To       string
+}
+
+// NewSMTPNotifier creates a notifier that emails to through the mail server in the common config.
+func NewSMTPNotifier(commonCfg *config.CommonConfig, to string) *SMTPNotifier {
+	port := commonCfg.SMTPPort
+	if port == 0 {
+		port = defaultSMTPPort
+	}
+	return &SMTPNotifier{
+		Addr:     net.JoinHostPort(commonCfg.SMTPHost, strconv.Itoa(port)),
+		Username: commonCfg.SMTPUsername,
+		Password: commonCfg.SMTPPassword,
+		From:     commonCfg.SMTPFrom,
+		To:       to,
+	}
+}
+
+// Notify sends one email listing all the changes.
+func (n *SMTPNotifier) Notify(username string, changes []scraper.LessonChange) error {
+	var auth smtp.Auth
+	if n.Username != "" {
+		host, _, err := net.SplitHostPort(n.Addr)
+		if err != nil {
+			return fmt.Errorf("invalid mail server address %s: %v", n.Addr, err)
+		}
+		auth = smtp.PlainAuth("", n.Username, n.Password, host)
+	}
+
+	if err := smtp.SendMail(n.Addr, auth, n.From, []string{n.To}, n.message(username, changes)); err != nil {
+		return fmt.Errorf("error emailing lesson changes to %s: %v", n.To, err)
+	}
+	return nil
+}
+
+// message builds the email, with CRLF line endings as SMTP requires.
+func (n *SMTPNotifier) message(username string, changes []scraper.LessonChange) []byte {
+	var sb strings.Builder
+	sb.WriteString("From: " + n.From + "\r\n")
+	sb.WriteString("To: " + n.To + "\r\n")
+	sb.WriteString("Subject: " + mime.QEncoding.Encode("utf-8", subject(changes)) + "\r\n")
+	sb.WriteString("Date: " + time.Now().Format(time.RFC1123Z) + "\r\n")
+	sb.WriteString("MIME-Version: 1.0\r\n")
+	sb.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	sb.WriteString("\r\n")
+	sb.WriteString(fmt.Sprintf("Hi %s,\r\n\r\nThese lessons on your FunTech timetable have changed:\r\n\r\n", username))
+	sb.WriteString(strings.ReplaceAll(Summary(changes), "\n", "\r\n"))
+	return []byte(sb.String())
+}
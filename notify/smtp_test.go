@@ -0,0 +1,58 @@
+package notify
+
+import (
+	"strings"
+	"testing"
+
+	"funtech-scraper/notify/smtptest"
+	"funtech-scraper/scraper"
+)
+
+func TestSMTPNotifier(t *testing.T) {
+	srv := smtptest.NewServer()
+	defer srv.Close()
+
+	n := &SMTPNotifier{Addr: srv.Addr, Username: "mailer", Password: "secret", From: "funtech@example.com", To: "alice@example.com"}
+	if err := n.Notify("alice", []scraper.LessonChange{movedLesson()}); err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+
+	messages := srv.Messages()
+	if len(messages) != 1 {
+		t.Fatalf("server received %d messages, want 1", len(messages))
+	}
+	message := messages[0]
+	if message.From != n.From || len(message.To) != 1 || message.To[0] != n.To || message.Username != n.Username {
+		t.Errorf("message from %q to %q as %q, want from %q to %q as %q",
+			message.From, message.To, message.Username, n.From, n.To, n.Username)
+	}
+
+	headers, body, _ := strings.Cut(message.Data, "\r\n\r\n")
+	if !strings.Contains(headers, "Subject: "+movedLessonText+"\r\n") {
+		t.Errorf("headers = %q, want the change as the subject", headers)
+	}
+	if !strings.Contains(body, "Hi alice,") || !strings.Contains(body, "\r\n"+movedLessonText) {
+		t.Errorf("body = %q, want a greeting and the change", body)
+	}
+}
+
+func TestSMTPNotifierSubjectCountsChanges(t *testing.T) {
+	srv := smtptest.NewServer()
+	defer srv.Close()
+
+	n := &SMTPNotifier{Addr: srv.Addr, From: "funtech@example.com", To: "alice@example.com"}
+	if err := n.Notify("alice", []scraper.LessonChange{movedLesson(), movedLesson()}); err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+
+	messages := srv.Messages()
+	if len(messages) != 1 {
+		t.Fatalf("server received %d messages, want 1", len(messages))
+	}
+	if !strings.Contains(messages[0].Data, "Subject: 2 changes to your FunTech lessons\r\n") {
+		t.Errorf("message = %q, want the number of changes as the subject", messages[0].Data)
+	}
+	if got := strings.Count(messages[0].Data, movedLessonText); got != 2 {
+		t.Errorf("message lists the change %d times, want 2", got)
+	}
+}
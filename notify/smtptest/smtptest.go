@@ -0,0 +1,159 @@
+// Package smtptest provides a local SMTP server that keeps the mail it receives, for end-to-end
+// testing of the email notifications.
+package smtptest
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/textproto"
+	"strings"
+	"sync"
+)
+
+// Message is an email received by the server.
+type Message struct {
+	From     string
+	To       []string
+	Username string // Set when the client logged in
+	Data     string // Headers and body, with CRLF line endings
+}
+
+// Server is a minimal SMTP server on localhost. It accepts every message and supports PLAIN auth
+// without checking the password, but not STARTTLS.
+type Server struct {
+	Addr string // host:port the server listens on
+
+	listener net.Listener
+	mu       sync.Mutex
+	messages []Message
+	wg       sync.WaitGroup
+}
+
+// NewServer starts a server on a free port on localhost. It panics if it cannot listen, like
+// httptest.NewServer.
+func NewServer() *Server {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic(fmt.Sprintf("smtptest: failed to listen on a port: %v", err))
+	}
+
+	s := &Server{Addr: listener.Addr().String(), listener: listener}
+	s.wg.Add(1)
+	go s.serve()
+	return s
+}
+
+// Messages returns the messages received so far.
+func (s *Server) Messages() []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Message(nil), s.messages...)
+}
+
+// Close stops the server and waits for open connections to finish.
+func (s *Server) Close() {
+	s.listener.Close()
+	s.wg.Wait()
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.handle(conn)
+		}()
+	}
+}
+
+// handle runs one SMTP session.
+func (s *Server) handle(conn net.Conn) {
+	defer conn.Close()
+	text := textproto.NewConn(conn)
+	reply := func(format string, args ...interface{}) bool {
+		return text.PrintfLine(format, args...) == nil
+	}
+
+	var message Message
+	username := ""
+	if !reply("220 smtptest ready") {
+		return
+	}
+	for {
+		line, err := text.ReadLine()
+		if err != nil {
+			return
+		}
+		verb, arg, _ := strings.Cut(line, " ")
+
+		ok := true
+		switch strings.ToUpper(verb) {
+		case "EHLO", "HELO":
+			ok = reply("250-smtptest\r\n250-8BITMIME\r\n250 AUTH PLAIN")
+		case "AUTH":
+			mechanism, initial, _ := strings.Cut(arg, " ")
+			if !strings.EqualFold(mechanism, "PLAIN") {
+				ok = reply("504 Unsupported authentication mechanism")
+				break
+			}
+			// The credentials are "identity\x00username\x00password"
+			decoded, err := base64.StdEncoding.DecodeString(initial)
+			parts := strings.Split(string(decoded), "\x00")
+			if err != nil || len(parts) != 3 {
+				ok = reply("501 Invalid credentials")
+				break
+			}
+			username = parts[1]
+			ok = reply("235 Authenticated")
+		case "MAIL":
+			message = Message{From: address(arg), Username: username}
+			ok = reply("250 OK")
+		case "RCPT":
+			message.To = append(message.To, address(arg))
+			ok = reply("250 OK")
+		case "DATA":
+			if !reply("354 End data with <CR><LF>.<CR><LF>") {
+				return
+			}
+			lines, err := text.ReadDotLines()
+			if err != nil {
+				return
+			}
+			message.Data = strings.Join(lines, "\r\n")
+			s.mu.Lock()
+			s.messages = append(s.messages, message)
+			s.mu.Unlock()
+			message = Message{}
+			ok = reply("250 OK")
+		case "RSET":
+			message = Message{}
+			ok = reply("250 OK")
+		case "NOOP":
+			ok = reply("250 OK")
+		case "QUIT":
+			reply("221 Bye")
+			return
+		default:
+			ok = reply("502 Command not implemented")
+		}
+		if !ok {
+			return
+		}
+	}
+}
+
+// address extracts the address from a "FROM:<address>" or "TO:<address>" argument.
+func address(arg string) string {
+	start := strings.Index(arg, "<")
+	end := strings.LastIndex(arg, ">")
+	if start < 0 || end < start {
+		return ""
+	}
+	return arg[start+1 : end]
+}
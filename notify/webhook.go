@@ -0,0 +1,96 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"funtech-scraper/scraper"
+)
+
+// WebhookNotifier posts the changes as JSON to a URL. The "text" field holds a readable summary, so
+// chat apps with incoming webhooks, such as Slack, can post it as it is.
+type WebhookNotifier struct {
+	URL  string
+	HTTP *http.Client
+}
+
+// NewWebhookNotifier creates a notifier that posts to url.
+func NewWebhookNotifier(url string) *WebhookNotifier {
+	return &WebhookNotifier{URL: url, HTTP: &http.Client{Timeout: 30 * time.Second}}
+}
+
+// webhookPayload is the JSON body posted to the webhook.
+type webhookPayload struct {
+	Username string          `json:"username"`
+	Text     string          `json:"text"`
+	Changes  []webhookChange `json:"changes"`
+}
+
+type webhookChange struct {
+	Kind       string         `json:"kind"`
+	LessonKey  string         `json:"lesson_key"`
+	Message    string         `json:"message"`
+	DetectedAt time.Time      `json:"detected_at"`
+	Old        *webhookLesson `json:"old,omitempty"`
+	New        *webhookLesson `json:"new,omitempty"`
+}
+
+type webhookLesson struct {
+	Course     string `json:"course"`
+	Day        string `json:"day"`
+	Date       string `json:"date"`
+	StartTime  string `json:"start_time"`
+	EndTime    string `json:"end_time"`
+	LessonType int    `json:"lesson_type"`
+}
+
+// Notify posts all the changes in one request.
+func (n *WebhookNotifier) Notify(username string, changes []scraper.LessonChange) error {
+	payload := webhookPayload{Username: username, Text: Summary(changes)}
+	for _, change := range changes {
+		payload.Changes = append(payload.Changes, webhookChange{
+			Kind:       string(change.Kind),
+			LessonKey:  change.Key,
+			Message:    change.String(),
+			DetectedAt: change.DetectedAt,
+			Old:        toWebhookLesson(change.Old),
+			New:        toWebhookLesson(change.New),
+		})
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("error encoding lesson changes: %v", err)
+	}
+	resp, err := n.HTTP.Post(n.URL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("error posting lesson changes to webhook: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("error posting lesson changes to webhook: %s: %s", resp.Status, strings.TrimSpace(string(message)))
+	}
+	return nil
+}
+
+// toWebhookLesson converts a lesson for the payload; a missing lesson is left out.
+func toWebhookLesson(lesson scraper.Lesson) *webhookLesson {
+	if lesson.Key == "" {
+		return nil
+	}
+	return &webhookLesson{
+		Course:     lesson.Course,
+		Day:        lesson.Day,
+		Date:       lesson.Date.Format("2006-01-02"),
+		StartTime:  lesson.StartTime,
+		EndTime:    lesson.EndTime,
+		LessonType: lesson.LessonType,
+	}
+}
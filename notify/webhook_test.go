@@ -0,0 +1,53 @@
+package notify
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"funtech-scraper/scraper"
+)
+
+func TestWebhookNotifier(t *testing.T) {
+	var payload webhookPayload
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("Content-Type = %q, want application/json", r.Header.Get("Content-Type"))
+		}
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			t.Errorf("error decoding payload: %v", err)
+		}
+	}))
+	defer srv.Close()
+
+	change := movedLesson()
+	if err := NewWebhookNotifier(srv.URL).Notify("alice", []scraper.LessonChange{change}); err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+
+	if payload.Username != "alice" || payload.Text != movedLessonText+"\n" {
+		t.Errorf("payload for %q with text %q, want for alice with %q", payload.Username, payload.Text, movedLessonText)
+	}
+	if len(payload.Changes) != 1 {
+		t.Fatalf("payload has %d changes, want 1", len(payload.Changes))
+	}
+	got := payload.Changes[0]
+	if got.Kind != "rescheduled" || got.LessonKey != change.Key || got.Message != movedLessonText {
+		t.Errorf("change = %+v, want the rescheduled lesson described as %q", got, movedLessonText)
+	}
+	if got.Old == nil || got.Old.StartTime != "16:00" || got.New == nil || got.New.StartTime != "17:00" || got.New.Date != "2024-09-26" {
+		t.Errorf("change lessons = %+v, %+v, want 16:00 and 17:00 on 2024-09-26", got.Old, got.New)
+	}
+}
+
+func TestWebhookNotifierReportsFailure(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "invalid token", http.StatusForbidden)
+	}))
+	defer srv.Close()
+
+	if err := NewWebhookNotifier(srv.URL).Notify("alice", []scraper.LessonChange{movedLesson()}); err == nil {
+		t.Fatalf("Notify succeeded, want the webhook's error")
+	}
+}
@@ -0,0 +1,96 @@
+package scraper
+
+import (
+	"sync"
+	"time"
+)
+
+// Availability is the academic year and the weeks of each term, as scraped from the availability
+// page of one portal account.
+type Availability struct {
+	Year        string
+	WeeksByTerm map[string][]Week
+	FetchedAt   time.Time
+}
+
+// AvailabilityCache keeps the availability scraped for each portal account, so the pages are only
+// scraped again once it is older than TTL. Failed scrapes are remembered too, so an account whose
+// login fails is only tried again after RetryAfter.
+type AvailabilityCache struct {
+	TTL        time.Duration
+	RetryAfter time.Duration
+
+	mu       sync.Mutex
+	entries  map[string]*Availability
+	failures map[string]time.Time // When scraping each account last failed
+}
+
+// NewAvailabilityCache creates an empty cache whose entries are fresh for ttl and whose failures
+// are remembered for retryAfter.
+func NewAvailabilityCache(ttl, retryAfter time.Duration) *AvailabilityCache {
+	return &AvailabilityCache{
+		TTL:        ttl,
+		RetryAfter: retryAfter,
+		entries:    make(map[string]*Availability),
+		failures:   make(map[string]time.Time),
+	}
+}
+
+// Fresh returns the availability cached for the account if it is younger than TTL.
+func (c *AvailabilityCache) Fresh(key string) (*Availability, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	availability, ok := c.entries[key]
+	if !ok || time.Since(availability.FetchedAt) >= c.TTL {
+		return nil, false
+	}
+	return availability, true
+}
+
+// Put caches the availability scraped for the account.
+func (c *AvailabilityCache) Put(key string, availability *Availability) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries[key] = availability
+	delete(c.failures, key)
+}
+
+// Failed reports whether scraping the account failed less than RetryAfter ago.
+func (c *AvailabilityCache) Failed(key string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	failedAt, ok := c.failures[key]
+	return ok && time.Since(failedAt) < c.RetryAfter
+}
+
+// PutFailure remembers that scraping the account failed.
+func (c *AvailabilityCache) PutFailure(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.failures[key] = time.Now()
+}
+
+// Fallback returns availability to use when scraping the account failed: the account's own
+// availability however old, or else the most recent of any other account's, with the key it was
+// cached under.
+func (c *AvailabilityCache) Fallback(key string) (*Availability, string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if availability, ok := c.entries[key]; ok {
+		return availability, key, true
+	}
+
+	var latest *Availability
+	latestKey := ""
+	for otherKey, availability := range c.entries {
+		if latest == nil || availability.FetchedAt.After(latest.FetchedAt) {
+			latest, latestKey = availability, otherKey
+		}
+	}
+	return latest, latestKey, latest != nil
+}
@@ -0,0 +1,35 @@
+package scraper
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAvailabilityCacheRemembersFailures(t *testing.T) {
+	cache := NewAvailabilityCache(24*time.Hour, time.Hour)
+	if cache.Failed("alice") {
+		t.Fatalf("Failed before any scrape, want false")
+	}
+
+	cache.PutFailure("alice")
+	if !cache.Failed("alice") {
+		t.Errorf("Failed right after a failure, want true")
+	}
+	if cache.Failed("bob") {
+		t.Errorf("another account Failed, want false")
+	}
+
+	cache.failures["alice"] = time.Now().Add(-2 * time.Hour)
+	if cache.Failed("alice") {
+		t.Errorf("Failed after RetryAfter has passed, want false")
+	}
+
+	cache.PutFailure("alice")
+	cache.Put("alice", &Availability{Year: "2024-25", FetchedAt: time.Now()})
+	if cache.Failed("alice") {
+		t.Errorf("Failed after a successful scrape, want false")
+	}
+	if _, ok := cache.Fresh("alice"); !ok {
+		t.Errorf("availability not fresh after a successful scrape")
+	}
+}
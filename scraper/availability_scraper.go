@@ -3,61 +3,40 @@ package scraper
 import (
 	"fmt"
 	"strings"
-
-	"github.com/PuerkitoBio/goquery"
-	"github.com/playwright-community/playwright-go"
 )
 
-// ScrapeAvailabilityWithClient scrapes the availability data using Playwright.
-func ScrapeAvailabilityWithClient(browser playwright.Browser, username, password string) ([]Term, map[string][]Week, string) {
-	availabilityURL := "https://funtech.co.uk/tutor/tutor_available_times"
-
-	// Step 1: Log in using the login function
-	page, err := login(browser, username, password)
-	if err != nil {
+// ScrapeAvailabilityWithClient scrapes the availability data through the portal client.
+func ScrapeAvailabilityWithClient(client PortalClient, username, password string) ([]Term, map[string][]Week, string) {
+	// Step 1: Log in using the portal client
+	if err := client.Login(username, password); err != nil {
 		fmt.Println("Login failed. Aborting availability scraping.")
 		return nil, nil, ""
 	}
+	defer func() {
+		if err := client.Logout(); err != nil {
+			fmt.Printf("Error logging out: %v\n", err)
+		}
+	}()
 
-	// Step 2: Navigate to the availability page after login and wait for it to fully load
-	if _, err := page.Goto(availabilityURL, playwright.PageGotoOptions{
-		WaitUntil: playwright.WaitUntilStateLoad, // Wait until the "load" event
-	}); err != nil {
-		fmt.Printf("Could not navigate to availability page: %v\n", err)
-		return nil, nil, ""
-	}
-
-	// Step 3: Scrape the availability data dynamically rendered via JavaScript
-	availabilityHTML, err := page.Content()
+	// Steps 2 & 3: Fetch the availability page after login
+	availabilityHTML, err := client.FetchAvailability()
 	if err != nil {
 		fmt.Printf("Could not get availability page content: %v\n", err)
 		return nil, nil, ""
 	}
 
-	// Step 4: Parse the availability HTML to extract data
+	// Steps 4-6: Parse the academic year and the terms with their links from the page
 	fmt.Println("Parsing the availability page HTML content...")
-	doc, err := goquery.NewDocumentFromReader(strings.NewReader(availabilityHTML))
+	academicYear, terms, err := ParseAvailabilityPage(strings.NewReader(availabilityHTML))
 	if err != nil {
-		fmt.Println("Error parsing availability HTML:", err)
+		fmt.Printf("Error parsing availability page: %v\n", err)
 		return nil, nil, ""
 	}
-
-	// Step 5: Extract the academic year from the page
-	year := extractYear(doc)
+	year := string(academicYear)
 	fmt.Printf("Extracted Academic Year: %s\n", year)
-	if year == "" {
-		fmt.Println("Warning: Could not extract academic year. HTML may be malformed or incorrect.")
-	}
-
-	// Step 6: Extract terms and their links from the page
-	terms := extractTerms(doc)
-	if len(terms) == 0 {
-		fmt.Println("No terms found. The page content may have changed, or there might be an issue with the scraping logic.")
-	} else {
-		fmt.Printf("Extracted %d terms:\n", len(terms))
-		for _, term := range terms {
-			fmt.Printf("Term Name: %s, URL: %s\n", term.Name, term.URL)
-		}
+	fmt.Printf("Extracted %d terms:\n", len(terms))
+	for _, term := range terms {
+		fmt.Printf("Term Name: %s, URL: %s\n", term.Name, term.URL)
 	}
 
 	// Step 7: Scrape weeks for each term and store them in a map
@@ -66,10 +45,10 @@ func ScrapeAvailabilityWithClient(browser playwright.Browser, username, password
 		var weeks []Week
 		if term.Name == "Term Time" {
 			fmt.Printf("Scraping weeks for Term Time: %s\n", term.Name)
-			weeks = extractWeeksForTermTimePlaywright(page, term.URL, term.Name, year)
+			weeks = extractWeeksForTermTime(client, term.URL, term.Name, year)
 		} else {
 			fmt.Printf("Scraping weeks for Term: %s\n", term.Name)
-			weeks = extractWeeksForTermPlaywright(page, term.URL, term.Name, year)
+			weeks = extractWeeksForTerm(client, term.URL, term.Name, year)
 		}
 
 		if len(weeks) == 0 {
@@ -0,0 +1,243 @@
+package scraper
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	ics "github.com/arran4/golang-ical"
+)
+
+const calendarQueryTemplate = `<?xml version="1.0" encoding="utf-8"?>
+<c:calendar-query xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:caldav">
+  <d:prop>
+    <d:getetag/>
+    <c:calendar-data/>
+  </d:prop>
+  <c:filter>
+    <c:comp-filter name="VCALENDAR">
+      <c:comp-filter name="VEVENT">%s</c:comp-filter>
+    </c:comp-filter>
+  </c:filter>
+</c:calendar-query>`
+
+// CalDAVSink syncs lessons into a calendar collection on a CalDAV server, such as Nextcloud,
+// Radicale or iCloud. Each managed event is stored as its own resource; events without a lesson
+// key are never changed.
+type CalDAVSink struct {
+	URL      string // Calendar collection URL
+	Username string
+	Password string
+	HTTP     *http.Client
+
+	// Resources found by the last listing, by href
+	uids  map[string]string
+	etags map[string]string
+}
+
+// NewCalDAVSink creates a sink for the calendar collection at collectionURL, using basic auth when
+// a username is given.
+func NewCalDAVSink(collectionURL, username, password string) *CalDAVSink {
+	if !strings.HasSuffix(collectionURL, "/") {
+		collectionURL += "/"
+	}
+	return &CalDAVSink{
+		URL:      collectionURL,
+		Username: username,
+		Password: password,
+		HTTP:     &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// multistatus is the body of a WebDAV 207 Multi-Status response.
+type multistatus struct {
+	Responses []struct {
+		Href      string `xml:"DAV: href"`
+		Propstats []struct {
+			Status string `xml:"DAV: status"`
+			Prop   struct {
+				ETag         string `xml:"DAV: getetag"`
+				CalendarData string `xml:"urn:ietf:params:xml:ns:caldav calendar-data"`
+			} `xml:"DAV: prop"`
+		} `xml:"DAV: propstat"`
+	} `xml:"DAV: response"`
+}
+
+// ListEvents runs a calendar-query REPORT for the events in the window. The ID of each event is the
+// href of the resource holding it.
+func (s *CalDAVSink) ListEvents(timeMin, timeMax time.Time) ([]CalendarEvent, error) {
+	timeRange := ""
+	if !timeMin.IsZero() || !timeMax.IsZero() {
+		timeRange = fmt.Sprintf(`<c:time-range start="%s" end="%s"/>`,
+			timeMin.UTC().Format("20060102T150405Z"), timeMax.UTC().Format("20060102T150405Z"))
+	}
+
+	req, err := s.newRequest("REPORT", s.URL, strings.NewReader(fmt.Sprintf(calendarQueryTemplate, timeRange)))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/xml; charset=utf-8")
+	req.Header.Set("Depth", "1")
+
+	resp, err := s.HTTP.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error querying CalDAV calendar: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusMultiStatus {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("error querying CalDAV calendar: %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	var result multistatus
+	if err := xml.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("error parsing CalDAV response: %v", err)
+	}
+
+	s.uids = make(map[string]string)
+	s.etags = make(map[string]string)
+	var events []CalendarEvent
+	for _, response := range result.Responses {
+		for _, propstat := range response.Propstats {
+			if !strings.Contains(propstat.Status, " 200 ") || propstat.Prop.CalendarData == "" {
+				continue
+			}
+			cal, err := ics.ParseCalendar(strings.NewReader(propstat.Prop.CalendarData))
+			if err != nil {
+				fmt.Printf("Skipping unreadable CalDAV resource %s: %v\n", response.Href, err)
+				continue
+			}
+			// Recurring events keep their exceptions in the same resource; only the master event is used
+			for _, vevent := range cal.Events() {
+				if vevent.GetProperty(ics.ComponentProperty(ics.PropertyRecurrenceId)) != nil {
+					continue
+				}
+				event, ok := fromICSEvent(vevent)
+				if !ok {
+					break
+				}
+				s.uids[response.Href] = event.ID
+				s.etags[response.Href] = propstat.Prop.ETag
+				event.ID = response.Href
+				events = append(events, event)
+				break
+			}
+		}
+	}
+	fmt.Printf("Fetched %d events from CalDAV calendar\n", len(events))
+	return events, nil
+}
+
+// ApplyPlan deletes, replaces and creates one resource per change. Updates replace the whole event.
+func (s *CalDAVSink) ApplyPlan(plan *SyncPlan) error {
+	var failures []string
+	changes := 0
+	record := func(description string, err error) {
+		changes++
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", description, err))
+		}
+	}
+
+	for _, event := range plan.Deletes {
+		fmt.Printf("Deleting event '%s' (%s)\n", event.Summary, event.ID)
+		record(fmt.Sprintf("deleting event '%s'", event.Summary), s.do(http.MethodDelete, event.ID, nil, s.etags[event.ID], false))
+	}
+
+	for _, update := range plan.Updates {
+		fmt.Printf("Updating event '%s' (Key: %s)\n", update.New.Summary, update.New.Key)
+		uid := s.uids[update.Old.ID]
+		if uid == "" {
+			uid = icsUID(update.New.Key)
+		}
+		record(fmt.Sprintf("updating event '%s'", update.New.Summary),
+			s.do(http.MethodPut, update.Old.ID, toICSEvent(update.New, uid), s.etags[update.Old.ID], false))
+	}
+
+	for _, event := range plan.Inserts {
+		fmt.Printf("Inserting new event '%s' (Key: %s)\n", event.Summary, event.Key)
+		uid := icsUID(event.Key)
+		record(fmt.Sprintf("inserting event '%s'", event.Summary),
+			s.do(http.MethodPut, url.PathEscape(uid)+".ics", toICSEvent(event, uid), "", true))
+	}
+
+	if len(failures) > 0 {
+		return fmt.Errorf("error syncing lessons with CalDAV calendar: %d of %d changes failed: %s", len(failures), changes, strings.Join(failures, "; "))
+	}
+	return nil
+}
+
+// do sends a request for a resource, given by an href or a path relative to the collection. PUT
+// requests carry the event; create only succeeds if the resource does not exist yet.
+func (s *CalDAVSink) do(method, href string, event *ics.VEvent, etag string, create bool) error {
+	target, err := s.resolve(href)
+	if err != nil {
+		return err
+	}
+
+	var body io.Reader
+	if event != nil {
+		cal := newICSCalendar()
+		cal.AddVEvent(event)
+		body = strings.NewReader(cal.Serialize())
+	}
+	req, err := s.newRequest(method, target, body)
+	if err != nil {
+		return err
+	}
+	if event != nil {
+		req.Header.Set("Content-Type", "text/calendar; charset=utf-8")
+	}
+	if create {
+		req.Header.Set("If-None-Match", "*")
+	} else if etag != "" {
+		req.Header.Set("If-Match", etag)
+	}
+
+	resp, err := s.HTTP.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if method == http.MethodDelete && (resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone) {
+		return nil // Already deleted
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(message)))
+	}
+	return nil
+}
+
+// resolve turns an href from the server, or a path relative to the collection, into a URL.
+func (s *CalDAVSink) resolve(href string) (string, error) {
+	base, err := url.Parse(s.URL)
+	if err != nil {
+		return "", fmt.Errorf("invalid CalDAV URL %s: %v", s.URL, err)
+	}
+	ref, err := url.Parse(href)
+	if err != nil {
+		return "", fmt.Errorf("invalid CalDAV href %s: %v", href, err)
+	}
+	return base.ResolveReference(ref).String(), nil
+}
+
+func (s *CalDAVSink) newRequest(method, target string, body io.Reader) (*http.Request, error) {
+	if body == nil {
+		body = bytes.NewReader(nil)
+	}
+	req, err := http.NewRequest(method, target, body)
+	if err != nil {
+		return nil, err
+	}
+	if s.Username != "" {
+		req.SetBasicAuth(s.Username, s.Password)
+	}
+	return req, nil
+}
@@ -0,0 +1,90 @@
+package scraper
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"funtech-scraper/scraper/caldavtest"
+)
+
+const ownEvent = "BEGIN:VCALENDAR\r\nVERSION:2.0\r\nPRODID:-//Example//Calendar//EN\r\n" +
+	"BEGIN:VEVENT\r\nUID:dentist@example.com\r\nDTSTAMP:20240901T000000Z\r\nSUMMARY:Dentist\r\n" +
+	"DTSTART:20240924T090000Z\r\nDTEND:20240924T100000Z\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n"
+
+func TestCalDAVSinkPutsAndDeletesLessons(t *testing.T) {
+	server, fake := caldavtest.NewServer()
+	t.Cleanup(server.Close)
+	fake.Put("dentist.ics", ownEvent)
+	sink := NewCalDAVSink(server.URL+caldavtest.CollectionPath, "tutor", "secret")
+
+	monday := testLesson("Python L2", 0, "16:00", "17:00")
+	thursday := testLesson("Scratch L1", 3, "16:00", "17:00")
+	mondayHref := caldavtest.CollectionPath + icsUID(monday.Key) + ".ics"
+	thursdayHref := caldavtest.CollectionPath + icsUID(thursday.Key) + ".ics"
+	ownHref := caldavtest.CollectionPath + "dentist.ics"
+
+	tests := []struct {
+		name         string
+		lessons      []Lesson
+		wantRequests []string
+		wantHrefs    []string
+	}{
+		{
+			name:         "lessons created",
+			lessons:      []Lesson{monday, thursday},
+			wantRequests: []string{"REPORT " + caldavtest.CollectionPath, "PUT " + mondayHref, "PUT " + thursdayHref},
+			wantHrefs:    []string{mondayHref, ownHref, thursdayHref},
+		},
+		{
+			name:         "lesson moved",
+			lessons:      []Lesson{testLesson("Python L2", 0, "17:00", "18:00"), thursday},
+			wantRequests: []string{"REPORT " + caldavtest.CollectionPath, "PUT " + mondayHref},
+			wantHrefs:    []string{mondayHref, ownHref, thursdayHref},
+		},
+		{
+			name:         "lesson removed",
+			lessons:      []Lesson{testLesson("Python L2", 0, "17:00", "18:00")},
+			wantRequests: []string{"REPORT " + caldavtest.CollectionPath, "DELETE " + thursdayHref},
+			wantHrefs:    []string{mondayHref, ownHref},
+		},
+		{
+			name:         "unchanged",
+			lessons:      []Lesson{testLesson("Python L2", 0, "17:00", "18:00")},
+			wantRequests: []string{"REPORT " + caldavtest.CollectionPath},
+			wantHrefs:    []string{mondayHref, ownHref},
+		},
+	}
+
+	// Each case syncs on top of the previous one
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake.ResetRequests()
+			if _, err := SyncLessons(sink, testWeek(tt.lessons...), SyncOptions{}); err != nil {
+				t.Fatal(err)
+			}
+			if got := fake.Requests(); !reflect.DeepEqual(got, tt.wantRequests) {
+				t.Errorf("requests = %q, want %q", got, tt.wantRequests)
+			}
+
+			resources := fake.Resources()
+			var hrefs []string
+			for href := range resources {
+				hrefs = append(hrefs, href)
+			}
+			sort.Strings(hrefs)
+			sort.Strings(tt.wantHrefs)
+			if !reflect.DeepEqual(hrefs, tt.wantHrefs) {
+				t.Errorf("resources = %q, want %q", hrefs, tt.wantHrefs)
+			}
+			if resources[ownHref] != ownEvent {
+				t.Errorf("the user's own event was changed:\n%s", resources[ownHref])
+			}
+		})
+	}
+
+	if data := fake.Resources()[mondayHref]; !strings.Contains(data, "DTSTART:20240923T160000Z") {
+		t.Errorf("moved lesson was not rewritten with its new time:\n%s", data)
+	}
+}
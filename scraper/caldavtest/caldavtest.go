@@ -0,0 +1,160 @@
+// Package caldavtest provides a fake CalDAV calendar collection for end-to-end testing of the sync.
+package caldavtest
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// CollectionPath is the path the fake serves its calendar collection under.
+const CollectionPath = "/calendars/tutor/lessons/"
+
+type resource struct {
+	data string
+	etag string
+}
+
+// Collection is an http.Handler that serves one in-memory CalDAV calendar collection. Every
+// resource is returned by calendar-query REPORTs, whatever the filter.
+type Collection struct {
+	mu        sync.Mutex
+	resources map[string]*resource // By href
+	version   int
+	requests  []string
+}
+
+// NewCollection creates a fake collection with no resources.
+func NewCollection() *Collection {
+	return &Collection{resources: make(map[string]*resource)}
+}
+
+// NewServer starts an httptest server for a fake collection. Pass server.URL+CollectionPath as the
+// collection URL of scraper.NewCalDAVSink. The caller should call Close when finished.
+func NewServer() (*httptest.Server, *Collection) {
+	fake := NewCollection()
+	return httptest.NewServer(fake), fake
+}
+
+// Put stores a resource under a name in the collection, as a calendar app would.
+func (c *Collection) Put(name, data string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.store(CollectionPath+name, data)
+}
+
+// Resources returns the iCalendar data of each resource, by href.
+func (c *Collection) Resources() map[string]string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	resources := make(map[string]string, len(c.resources))
+	for href, res := range c.resources {
+		resources[href] = res.data
+	}
+	return resources
+}
+
+// Requests returns the method and path of each request received so far.
+func (c *Collection) Requests() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]string(nil), c.requests...)
+}
+
+// ResetRequests clears the recorded requests.
+func (c *Collection) ResetRequests() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.requests = nil
+}
+
+// ServeHTTP handles REPORT on the collection and PUT and DELETE on its resources, honouring
+// If-Match and If-None-Match.
+func (c *Collection) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.requests = append(c.requests, r.Method+" "+r.URL.Path)
+
+	if r.Method == "REPORT" && r.URL.Path == CollectionPath {
+		c.report(w)
+		return
+	}
+	if !strings.HasPrefix(r.URL.Path, CollectionPath) || r.URL.Path == CollectionPath {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+
+	existing := c.resources[r.URL.Path]
+	if match := r.Header.Get("If-Match"); match != "" && (existing == nil || existing.etag != match) {
+		http.Error(w, "etag does not match", http.StatusPreconditionFailed)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPut:
+		if r.Header.Get("If-None-Match") == "*" && existing != nil {
+			http.Error(w, "resource exists", http.StatusPreconditionFailed)
+			return
+		}
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		c.store(r.URL.Path, string(body))
+		if existing == nil {
+			w.WriteHeader(http.StatusCreated)
+		} else {
+			w.WriteHeader(http.StatusNoContent)
+		}
+	case http.MethodDelete:
+		if existing == nil {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		delete(c.resources, r.URL.Path)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// report writes a 207 Multi-Status listing every resource with its etag and data.
+func (c *Collection) report(w http.ResponseWriter) {
+	hrefs := make([]string, 0, len(c.resources))
+	for href := range c.resources {
+		hrefs = append(hrefs, href)
+	}
+	sort.Strings(hrefs)
+
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0" encoding="utf-8"?>` + "\n" + `<d:multistatus xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:caldav">`)
+	for _, href := range hrefs {
+		res := c.resources[href]
+		fmt.Fprintf(&b, `<d:response><d:href>%s</d:href><d:propstat><d:prop><d:getetag>%s</d:getetag><c:calendar-data>`,
+			escape(href), escape(res.etag))
+		b.WriteString(escape(res.data))
+		b.WriteString(`</c:calendar-data></d:prop><d:status>HTTP/1.1 200 OK</d:status></d:propstat></d:response>`)
+	}
+	b.WriteString(`</d:multistatus>`)
+
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.WriteHeader(http.StatusMultiStatus)
+	io.WriteString(w, b.String())
+}
+
+func (c *Collection) store(href, data string) {
+	c.version++
+	c.resources[href] = &resource{data: data, etag: fmt.Sprintf(`"%d"`, c.version)}
+}
+
+func escape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
@@ -0,0 +1,115 @@
+package scraper
+
+import (
+	"fmt"
+	"time"
+
+	"funtech-scraper/config"
+)
+
+// CalendarSink is a calendar the lessons can be synced into.
+type CalendarSink interface {
+	// ListEvents returns the events in the calendar that overlap timeMin and timeMax, or all events
+	// if both are zero. Events not created by the sync are returned with Managed unset.
+	ListEvents(timeMin, timeMax time.Time) ([]CalendarEvent, error)
+	// ApplyPlan makes the changes in the plan to the calendar. It attempts every change and
+	// reports the failed ones together.
+	ApplyPlan(plan *SyncPlan) error
+}
+
+// NewCalendarSink creates the calendar sink configured for the user. The Google sink saves refreshed
+// tokens to the user's entry in users, and uses and updates state to list only the events changed since the last sync;
+// state may be nil.
+func NewCalendarSink(commonCfg *config.CommonConfig, users config.UserStore, username string, userCfg *config.UserConfig, state *SyncState) (CalendarSink, error) {
+	switch userCfg.CalendarSink {
+	case "", "google":
+		if userCfg.GoogleCalendarID == "" {
+			return nil, fmt.Errorf("no Google Calendar selected for user: %s", userCfg.Username)
+		}
+		client, err := GetCalendarClient(commonCfg, users, username, userCfg)
+		if err != nil {
+			return nil, err
+		}
+		return &GoogleSink{Client: client, CalendarID: userCfg.GoogleCalendarID, State: state}, nil
+	case "ics":
+		if userCfg.ICSPath == "" {
+			return nil, fmt.Errorf("ics_path must be set for the ics calendar sink")
+		}
+		return &ICSFileSink{Path: userCfg.ICSPath}, nil
+	case "caldav":
+		if userCfg.CalDAVURL == "" {
+			return nil, fmt.Errorf("caldav_url must be set for the caldav calendar sink")
+		}
+		return NewCalDAVSink(userCfg.CalDAVURL, userCfg.CalDAVUsername, userCfg.CalDAVPassword), nil
+	case config.CalendarSinkFeed:
+		return nil, fmt.Errorf("user %s only uses the lesson feed and has no calendar to sync", userCfg.Username)
+	default:
+		return nil, fmt.Errorf("unknown calendar sink %q", userCfg.CalendarSink)
+	}
+}
+
+// SyncLessons syncs the lessons into the calendar, matching events to lessons by their stable lesson
+// key so rescheduled lessons are updated in place. Events not created by the sync are left untouched,
+// so the calendar can be shared with the tutor's own events. The returned plan lists the changes
+// made, or the changes that were refused when a *SyncBlockedError is returned.
+func SyncLessons(sink CalendarSink, results []ScrapeResult, opts SyncOptions) (*SyncPlan, error) {
+	if opts.ClearAll && !opts.DryRun {
+		err := ClearSink(sink)
+		if err != nil {
+			return nil, fmt.Errorf("error clearing calendar: %v", err)
+		}
+	}
+
+	plan, err := PlanSync(sink, results, opts.AdoptUntagged)
+	if err != nil {
+		return nil, err
+	}
+	fmt.Print(plan)
+
+	if err := CheckSyncPlan(plan, opts.MaxDeleteFraction); err != nil {
+		return plan, err
+	}
+	if opts.DryRun {
+		return plan, nil
+	}
+
+	if err := sink.ApplyPlan(plan); err != nil {
+		return plan, err
+	}
+	fmt.Println("Lessons successfully synced with the calendar.")
+	return plan, nil
+}
+
+// PlanSync works out the changes needed to sync the scraped lessons into the calendar without making them.
+// Only events in the period covered by the scrape are considered. See BuildSyncPlan for adoptUntagged.
+func PlanSync(sink CalendarSink, results []ScrapeResult, adoptUntagged bool) (*SyncPlan, error) {
+	timeMin, timeMax := ScrapeWindow(results)
+	events, err := sink.ListEvents(timeMin, timeMax)
+	if err != nil {
+		// Wrapped so callers can tell a *GoogleAuthError from failures worth retrying
+		return nil, fmt.Errorf("error fetching events from calendar: %w", err)
+	}
+
+	return BuildSyncPlan(events, results, adoptUntagged), nil
+}
+
+// ClearSink deletes all events created by the sync from the calendar.
+func ClearSink(sink CalendarSink) error {
+	events, err := sink.ListEvents(time.Time{}, time.Time{})
+	if err != nil {
+		return fmt.Errorf("error fetching events from calendar: %v", err)
+	}
+
+	plan := &SyncPlan{}
+	for _, event := range events {
+		if event.Managed {
+			plan.Deletes = append(plan.Deletes, event)
+		}
+	}
+	if err := sink.ApplyPlan(plan); err != nil {
+		return err
+	}
+
+	fmt.Printf("All %d synced events cleared from the calendar.\n", len(plan.Deletes))
+	return nil
+}
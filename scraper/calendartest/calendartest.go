@@ -0,0 +1,410 @@
+// Package calendartest provides a fake Google Calendar API server for end-to-end testing of the sync.
+package calendartest
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/api/calendar/v3"
+)
+
+const (
+	// BasePath is the path the fake serves the Calendar API under.
+	BasePath  = "/calendar/v3/"
+	batchPath = "/batch/calendar/v3"
+	pageSize  = 250
+)
+
+// Calendar is an http.Handler that serves a fake Google Calendar API backed by in-memory calendars.
+type Calendar struct {
+	mu        sync.Mutex
+	calendars map[string]map[string]*calendar.Event
+	nextID    int
+	requests  []string
+	failures  []int
+	// version counts changes; each event remembers the version it was last changed in, and
+	// sync tokens are the version of the listing they were issued with.
+	version        int
+	versions       map[string]int
+	minSyncVersion int
+}
+
+// NewCalendar creates a fake Calendar API with no events.
+func NewCalendar() *Calendar {
+	return &Calendar{calendars: make(map[string]map[string]*calendar.Event), versions: make(map[string]int)}
+}
+
+// NewServer starts an httptest server for a fake Calendar API. Pass server.URL+BasePath as the
+// endpoint of scraper.NewGoogleCalendarClient. The caller should call Close when finished.
+func NewServer() (*httptest.Server, *Calendar) {
+	fake := NewCalendar()
+	return httptest.NewServer(fake), fake
+}
+
+// AddEvent stores an event in a calendar, assigning it an ID if it has none.
+func (c *Calendar) AddEvent(calendarID string, event *calendar.Event) *calendar.Event {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.insert(calendarID, event)
+}
+
+// Events returns the events in a calendar, ordered by ID.
+func (c *Calendar) Events(calendarID string) []*calendar.Event {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.list(calendarID)
+}
+
+// FailNext makes the next API calls fail with the given HTTP status codes, one code per call.
+// Calls inside a batch request count individually.
+func (c *Calendar) FailNext(codes ...int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.failures = append(c.failures, codes...)
+}
+
+// ExpireSyncTokens makes listings with any sync token issued so far fail with 410 Gone, as Google
+// does when a token is too old.
+func (c *Calendar) ExpireSyncTokens() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.version++
+	c.minSyncVersion = c.version
+}
+
+// Requests returns the method and path of every HTTP request received, in order. A batch
+// request counts as a single request.
+func (c *Calendar) Requests() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]string(nil), c.requests...)
+}
+
+// ResetRequests clears the recorded requests.
+func (c *Calendar) ResetRequests() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.requests = nil
+}
+
+// ServeHTTP implements http.Handler.
+func (c *Calendar) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	c.mu.Lock()
+	c.requests = append(c.requests, r.Method+" "+r.URL.Path)
+	c.mu.Unlock()
+
+	if r.URL.Path == batchPath {
+		c.serveBatch(w, r)
+		return
+	}
+	c.serveCall(w, r)
+}
+
+// serveBatch answers a multipart/mixed batch request by serving each part as a separate call.
+func (c *Calendar) serveBatch(w http.ResponseWriter, r *http.Request) {
+	mediaType, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/mixed" {
+		writeError(w, http.StatusBadRequest, "badRequest", "batch requests must be multipart/mixed")
+		return
+	}
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	reader := multipart.NewReader(r.Body, params["boundary"])
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "badRequest", err.Error())
+			return
+		}
+
+		itemReq, err := http.ReadRequest(bufio.NewReader(part))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "badRequest", err.Error())
+			return
+		}
+		recorder := httptest.NewRecorder()
+		c.serveCall(recorder, itemReq)
+
+		header := textproto.MIMEHeader{}
+		header.Set("Content-Type", "application/http")
+		if contentID := strings.Trim(part.Header.Get("Content-ID"), "<>"); contentID != "" {
+			header.Set("Content-ID", "<response-"+contentID+">")
+		}
+		responsePart, err := writer.CreatePart(header)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "backendError", err.Error())
+			return
+		}
+		recorder.Result().Write(responsePart)
+	}
+	writer.Close()
+
+	w.Header().Set("Content-Type", "multipart/mixed; boundary="+writer.Boundary())
+	w.Write(body.Bytes())
+}
+
+// serveCall serves a single Calendar API call.
+func (c *Calendar) serveCall(w http.ResponseWriter, r *http.Request) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.failures) > 0 {
+		code := c.failures[0]
+		c.failures = c.failures[1:]
+		reason := "backendError"
+		if code == http.StatusForbidden || code == http.StatusTooManyRequests {
+			reason = "rateLimitExceeded"
+		}
+		if code == http.StatusTooManyRequests {
+			w.Header().Set("Retry-After", "1")
+		}
+		writeError(w, code, reason, "injected failure")
+		return
+	}
+
+	path := strings.TrimPrefix(r.URL.Path, BasePath)
+	if path == "users/me/calendarList" && r.Method == http.MethodGet {
+		c.listCalendars(w)
+		return
+	}
+
+	// calendars/{calendarId}/events[/{eventId}]
+	segments := strings.Split(path, "/")
+	if len(segments) < 3 || segments[0] != "calendars" || segments[2] != "events" || len(segments) > 4 {
+		writeError(w, http.StatusNotFound, "notFound", "Not Found")
+		return
+	}
+	calendarID := segments[1]
+
+	if len(segments) == 3 {
+		switch r.Method {
+		case http.MethodGet:
+			c.listEvents(w, r, calendarID)
+		case http.MethodPost:
+			var event calendar.Event
+			if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+				writeError(w, http.StatusBadRequest, "parseError", err.Error())
+				return
+			}
+			writeJSON(w, http.StatusOK, c.insert(calendarID, &event))
+		default:
+			writeError(w, http.StatusMethodNotAllowed, "badRequest", "Method Not Allowed")
+		}
+		return
+	}
+
+	eventID := segments[3]
+	event, found := c.calendars[calendarID][eventID]
+	if !found || event.Status == "cancelled" {
+		if found && r.Method == http.MethodDelete {
+			writeError(w, http.StatusGone, "deleted", "Resource has been deleted")
+			return
+		}
+		writeError(w, http.StatusNotFound, "notFound", "Not Found")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, event)
+	case http.MethodPatch, http.MethodPut:
+		updated := &calendar.Event{}
+		if r.Method == http.MethodPatch {
+			// Patching only replaces the fields present in the request
+			*updated = *event
+			if event.ExtendedProperties != nil {
+				properties := *event.ExtendedProperties
+				properties.Private = copyProperties(properties.Private)
+				updated.ExtendedProperties = &properties
+			}
+		}
+		if err := json.NewDecoder(r.Body).Decode(updated); err != nil {
+			writeError(w, http.StatusBadRequest, "parseError", err.Error())
+			return
+		}
+		updated.Id = eventID
+		updated.Status = "confirmed"
+		c.calendars[calendarID][eventID] = updated
+		c.changed(calendarID, eventID)
+		writeJSON(w, http.StatusOK, updated)
+	case http.MethodDelete:
+		event.Status = "cancelled"
+		c.changed(calendarID, eventID)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "badRequest", "Method Not Allowed")
+	}
+}
+
+// listEvents serves a page of a calendar's events. A full listing returns the confirmed events
+// overlapping timeMin and timeMax; a listing with a sync token returns the events changed since,
+// including deleted ones, like the real API.
+func (c *Calendar) listEvents(w http.ResponseWriter, r *http.Request, calendarID string) {
+	query := r.URL.Query()
+	var events []*calendar.Event
+	if syncToken := query.Get("syncToken"); syncToken != "" {
+		if query.Get("timeMin") != "" || query.Get("timeMax") != "" {
+			writeError(w, http.StatusBadRequest, "invalid", "syncToken cannot be combined with timeMin or timeMax")
+			return
+		}
+		since, err := strconv.Atoi(syncToken)
+		if err != nil || since < c.minSyncVersion {
+			writeError(w, http.StatusGone, "fullSyncRequired", "Sync token is no longer valid, a full sync is required.")
+			return
+		}
+		for _, event := range c.list(calendarID) {
+			if c.versions[calendarID+"/"+event.Id] > since {
+				events = append(events, event)
+			}
+		}
+		for _, event := range c.cancelled(calendarID) {
+			if c.versions[calendarID+"/"+event.Id] > since {
+				events = append(events, event)
+			}
+		}
+	} else {
+		timeMin, _ := time.Parse(time.RFC3339, query.Get("timeMin"))
+		timeMax, _ := time.Parse(time.RFC3339, query.Get("timeMax"))
+		for _, event := range c.list(calendarID) {
+			start, end := eventTimes(event)
+			if (!timeMin.IsZero() && !end.After(timeMin)) || (!timeMax.IsZero() && !start.Before(timeMax)) {
+				continue
+			}
+			events = append(events, event)
+		}
+	}
+
+	start, _ := strconv.Atoi(query.Get("pageToken"))
+	if start > len(events) {
+		start = len(events)
+	}
+	end := start + pageSize
+	response := &calendar.Events{}
+	if end < len(events) {
+		response.NextPageToken = strconv.Itoa(end)
+	} else {
+		end = len(events)
+		response.NextSyncToken = strconv.Itoa(c.version)
+	}
+	response.Items = events[start:end]
+	writeJSON(w, http.StatusOK, response)
+}
+
+// listCalendars serves the user's calendar list.
+func (c *Calendar) listCalendars(w http.ResponseWriter) {
+	ids := make([]string, 0, len(c.calendars))
+	for id := range c.calendars {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	response := &calendar.CalendarList{}
+	for _, id := range ids {
+		response.Items = append(response.Items, &calendar.CalendarListEntry{Id: id, Summary: id})
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+func (c *Calendar) insert(calendarID string, event *calendar.Event) *calendar.Event {
+	if c.calendars[calendarID] == nil {
+		c.calendars[calendarID] = make(map[string]*calendar.Event)
+	}
+	if event.Id == "" {
+		c.nextID++
+		event.Id = fmt.Sprintf("event%06d", c.nextID)
+	}
+	event.Status = "confirmed"
+	c.calendars[calendarID][event.Id] = event
+	c.changed(calendarID, event.Id)
+	return event
+}
+
+// changed records that an event has changed.
+func (c *Calendar) changed(calendarID, eventID string) {
+	c.version++
+	c.versions[calendarID+"/"+eventID] = c.version
+}
+
+// list returns the confirmed events of a calendar, ordered by ID.
+func (c *Calendar) list(calendarID string) []*calendar.Event {
+	var events []*calendar.Event
+	for _, event := range c.calendars[calendarID] {
+		if event.Status != "cancelled" {
+			events = append(events, event)
+		}
+	}
+	sort.Slice(events, func(i, j int) bool { return events[i].Id < events[j].Id })
+	return events
+}
+
+// cancelled returns the deleted events of a calendar, ordered by ID.
+func (c *Calendar) cancelled(calendarID string) []*calendar.Event {
+	var events []*calendar.Event
+	for _, event := range c.calendars[calendarID] {
+		if event.Status == "cancelled" {
+			events = append(events, &calendar.Event{Id: event.Id, Status: "cancelled"})
+		}
+	}
+	sort.Slice(events, func(i, j int) bool { return events[i].Id < events[j].Id })
+	return events
+}
+
+// eventTimes returns the start and end of a timed or all-day event.
+func eventTimes(event *calendar.Event) (time.Time, time.Time) {
+	parse := func(value *calendar.EventDateTime) time.Time {
+		if value == nil {
+			return time.Time{}
+		}
+		if parsed, err := time.Parse(time.RFC3339, value.DateTime); err == nil {
+			return parsed
+		}
+		parsed, _ := time.Parse("2006-01-02", value.Date)
+		return parsed
+	}
+	return parse(event.Start), parse(event.End)
+}
+
+func copyProperties(properties map[string]string) map[string]string {
+	if properties == nil {
+		return nil
+	}
+	copied := make(map[string]string, len(properties))
+	for key, value := range properties {
+		copied[key] = value
+	}
+	return copied
+}
+
+func writeJSON(w http.ResponseWriter, code int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(value)
+}
+
+// writeError responds with an error in the format of the Google APIs.
+func writeError(w http.ResponseWriter, code int, reason, message string) {
+	writeJSON(w, code, map[string]interface{}{
+		"error": map[string]interface{}{
+			"code":    code,
+			"message": message,
+			"errors":  []map[string]string{{"reason": reason, "message": message}},
+		},
+	})
+}
@@ -0,0 +1,84 @@
+package scraper
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// FixtureClient is a PortalClient that replays portal pages recorded as HTML files.
+//
+// Each page is looked up by its portal path with ':' replaced by '_' and ".html" appended,
+// so "/tutor/tutors/tt_week_schedule/year:2024-25/term:1/week:3" is read from
+// "<dir>/tutor/tutors/tt_week_schedule/year_2024-25/term_1/week_3.html".
+type FixtureClient struct {
+	dir      string
+	loggedIn bool
+}
+
+// NewFixtureClient creates a PortalClient that serves recorded pages from dir.
+func NewFixtureClient(dir string) *FixtureClient {
+	return &FixtureClient{dir: dir}
+}
+
+// Login accepts any credentials as long as the fixtures directory exists.
+func (c *FixtureClient) Login(username, password string) error {
+	info, err := os.Stat(c.dir)
+	if err != nil {
+		return fmt.Errorf("fixtures directory unavailable: %v", err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("fixtures path %s is not a directory", c.dir)
+	}
+	c.loggedIn = true
+	return nil
+}
+
+// FetchAvailability returns the recorded availability overview page.
+func (c *FixtureClient) FetchAvailability() (string, error) {
+	return c.fetch(availabilityPath)
+}
+
+// FetchTerm returns the recorded availability page for a term.
+func (c *FixtureClient) FetchTerm(termPath string) (string, error) {
+	return c.fetch(termPath)
+}
+
+// FetchWeekAvailability returns the recorded availability page for a week.
+func (c *FixtureClient) FetchWeekAvailability(weekPath string) (string, error) {
+	return c.fetch(weekPath)
+}
+
+// FetchWeekSchedule returns the recorded timetable for a week of a term.
+func (c *FixtureClient) FetchWeekSchedule(year string, term, week int) (string, error) {
+	return c.fetch(weekSchedulePathFor(year, term, week))
+}
+
+// Logout ends the replayed session.
+func (c *FixtureClient) Logout() error {
+	c.loggedIn = false
+	return nil
+}
+
+// fetch reads the fixture recorded for a portal path.
+func (c *FixtureClient) fetch(path string) (string, error) {
+	if !c.loggedIn {
+		return "", fmt.Errorf("not logged in")
+	}
+
+	content, err := os.ReadFile(fixturePath(c.dir, path))
+	if err != nil {
+		return "", fmt.Errorf("no fixture for %s: %v", path, err)
+	}
+	return string(content), nil
+}
+
+// fixturePath maps a portal path to the file it is recorded in under dir.
+func fixturePath(dir, path string) string {
+	if i := strings.IndexAny(path, "?#"); i >= 0 {
+		path = path[:i]
+	}
+	name := strings.ReplaceAll(strings.Trim(path, "/"), ":", "_")
+	return filepath.Join(dir, filepath.FromSlash(name)+".html")
+}
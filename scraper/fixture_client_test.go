@@ -0,0 +1,109 @@
+package scraper
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// copyFixture records a testdata page under dir as the fixture for a portal path.
+func copyFixture(t *testing.T, dir, path, testdata string) {
+	t.Helper()
+	content, err := os.ReadFile(filepath.Join("testdata", testdata))
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := fixturePath(dir, path)
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(file, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFixturePath(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{path: "/tutor/tutor_available_times", want: "fixtures/tutor/tutor_available_times.html"},
+		{path: "/tutor/tutor_available_times/index/1?tab=2#top", want: "fixtures/tutor/tutor_available_times/index/1.html"},
+		{path: weekSchedulePathFor("2024-25", 1, 3), want: "fixtures/tutor/tutors/tt_week_schedule/year_2024-25/term_1/week_3.html"},
+	}
+
+	for _, tt := range tests {
+		if got := fixturePath("fixtures", tt.path); got != filepath.FromSlash(tt.want) {
+			t.Errorf("fixturePath(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestFixtureClientWeeks(t *testing.T) {
+	dir := t.TempDir()
+	copyFixture(t, dir, weekSchedulePathFor("2024-25", 1, 1), "week_schedule.html")
+	copyFixture(t, dir, weekSchedulePathFor("2024-25", 1, 2), "week_schedule_empty.html")
+
+	weeks := []Week{
+		{Term: 1, WeekNumber: 1, StartDate: "23/09/2024"},
+		{Term: 1, WeekNumber: 2, StartDate: "30/09/2024"},
+		{Term: 1, WeekNumber: 3, StartDate: "07/10/2024"},
+	}
+	results, err := ScrapeLessonsWithClient(NewFixtureClient(dir), "tutor", "secret", weeks, "2024-25")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantStatuses := []ScrapeStatus{ScrapeOK, ScrapeEmpty, ScrapeFailed}
+	if len(results) != len(wantStatuses) {
+		t.Fatalf("got %d results, want %d", len(results), len(wantStatuses))
+	}
+	for i, result := range results {
+		if result.Status != wantStatuses[i] {
+			t.Errorf("week %d status = %v, want %v", i+1, result.Status, wantStatuses[i])
+		}
+	}
+	if len(results[0].Lessons) == 0 {
+		t.Error("week 1 has no lessons")
+	}
+
+	// The week with no recording fails, naming the page that is missing
+	wantErr := "no fixture for " + weekSchedulePathFor("2024-25", 1, 3)
+	if err := results[2].Err; err == nil || !strings.Contains(err.Error(), wantErr) {
+		t.Errorf("week 3 error = %v, want it to contain %q", err, wantErr)
+	}
+}
+
+func TestFixtureClientErrors(t *testing.T) {
+	dir := t.TempDir()
+	copyFixture(t, dir, availabilityPath, "availability.html")
+
+	client := NewFixtureClient(dir)
+	if _, err := client.FetchAvailability(); err == nil || err.Error() != "not logged in" {
+		t.Errorf("fetch before login = %v, want not logged in", err)
+	}
+	if err := client.Login("tutor", "secret"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.FetchAvailability(); err != nil {
+		t.Errorf("FetchAvailability: %v", err)
+	}
+	if _, err := client.FetchTerm(availabilityPath + "/index/1"); err == nil || !strings.Contains(err.Error(), "no fixture for") {
+		t.Errorf("FetchTerm of a missing page = %v, want no fixture", err)
+	}
+	if err := client.Logout(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.FetchAvailability(); err == nil {
+		t.Error("fetch after logout succeeded")
+	}
+
+	if err := NewFixtureClient(filepath.Join(dir, "missing")).Login("tutor", "secret"); err == nil {
+		t.Error("login with a missing fixtures directory succeeded")
+	}
+	file := fixturePath(dir, availabilityPath)
+	if err := NewFixtureClient(file).Login("tutor", "secret"); err == nil || !strings.Contains(err.Error(), "not a directory") {
+		t.Errorf("login with a file for fixtures directory = %v, want not a directory", err)
+	}
+}
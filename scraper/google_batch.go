@@ -0,0 +1,243 @@
+package scraper
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/api/calendar/v3"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/option"
+)
+
+const (
+	defaultBatchURL = "https://www.googleapis.com/batch/calendar/v3"
+	maxBatchSize    = 50 // Google accepts at most 50 calls in one batch request
+)
+
+// GoogleCalendarClient bundles the Calendar API service with the HTTP client behind it, which
+// batch requests are sent through.
+type GoogleCalendarClient struct {
+	Service  *calendar.Service
+	HTTP     *http.Client
+	BatchURL string
+}
+
+// NewGoogleCalendarClient creates a Calendar API client using an authorised HTTP client. An empty
+// endpoint targets Google; otherwise endpoint is the API base URL (e.g. "http://host/calendar/v3/")
+// and batch requests are sent to "/batch/calendar/v3" on the same host.
+func NewGoogleCalendarClient(httpClient *http.Client, endpoint string) (*GoogleCalendarClient, error) {
+	opts := []option.ClientOption{option.WithHTTPClient(httpClient)}
+	batchURL := defaultBatchURL
+	if endpoint != "" {
+		opts = append(opts, option.WithEndpoint(endpoint))
+		endpointURL, err := url.Parse(endpoint)
+		if err != nil {
+			return nil, fmt.Errorf("invalid calendar endpoint %s: %v", endpoint, err)
+		}
+		batchURL = endpointURL.Scheme + "://" + endpointURL.Host + "/batch/calendar/v3"
+	}
+
+	srv, err := calendar.NewService(context.Background(), opts...)
+	if err != nil {
+		return nil, fmt.Errorf("unable to retrieve Calendar client: %v", err)
+	}
+	return &GoogleCalendarClient{Service: srv, HTTP: httpClient, BatchURL: batchURL}, nil
+}
+
+// batchCall is a single Calendar API call sent as part of a batch request.
+type batchCall struct {
+	Method      string
+	Path        string      // Path relative to the API base, e.g. "calendars/primary/events"
+	Body        interface{} // Encoded as JSON when not nil
+	Description string      // Used in error messages
+}
+
+// deleteEventCall builds the batch call that deletes an event.
+func deleteEventCall(calendarID, eventID string) batchCall {
+	return batchCall{
+		Method: http.MethodDelete,
+		Path:   "calendars/" + url.PathEscape(calendarID) + "/events/" + url.PathEscape(eventID),
+	}
+}
+
+// patchEventCall builds the batch call that patches an event.
+func patchEventCall(calendarID, eventID string, event *calendar.Event) batchCall {
+	return batchCall{
+		Method: http.MethodPatch,
+		Path:   "calendars/" + url.PathEscape(calendarID) + "/events/" + url.PathEscape(eventID),
+		Body:   event,
+	}
+}
+
+// insertEventCall builds the batch call that inserts an event.
+func insertEventCall(calendarID string, event *calendar.Event) batchCall {
+	return batchCall{
+		Method: http.MethodPost,
+		Path:   "calendars/" + url.PathEscape(calendarID) + "/events",
+		Body:   event,
+	}
+}
+
+// runBatch sends the calls in batch requests of up to maxBatchSize and returns the error of each
+// call, in order. Calls that fail with a retryable error are retried with backoff in later batches,
+// so one rate-limited call does not hold up or abort the rest.
+func (c *GoogleCalendarClient) runBatch(calls []batchCall) []error {
+	errs := make([]error, len(calls))
+	pending := make([]int, len(calls))
+	for i := range calls {
+		pending[i] = i
+	}
+
+	var delay time.Duration
+	for attempt := 1; attempt <= maxGoogleAttempts && len(pending) > 0; attempt++ {
+		if attempt > 1 {
+			fmt.Printf("Retrying %d Google Calendar changes in %v\n", len(pending), delay.Round(time.Millisecond))
+			time.Sleep(delay)
+		}
+
+		var retry []int
+		delay = 0
+		for start := 0; start < len(pending); start += maxBatchSize {
+			end := start + maxBatchSize
+			if end > len(pending) {
+				end = len(pending)
+			}
+			chunk := pending[start:end]
+
+			chunkCalls := make([]batchCall, len(chunk))
+			for i, index := range chunk {
+				chunkCalls[i] = calls[index]
+			}
+			chunkErrs := c.sendBatch(chunkCalls)
+			for i, index := range chunk {
+				errs[index] = chunkErrs[i]
+				if chunkErrs[i] != nil && IsRetryableGoogleError(chunkErrs[i]) {
+					retry = append(retry, index)
+					// Wait as long as the most demanding failure asks
+					if itemDelay := RetryDelay(chunkErrs[i], attempt); itemDelay > delay {
+						delay = itemDelay
+					}
+				}
+			}
+		}
+		pending = retry
+	}
+
+	return errs
+}
+
+// sendBatch sends one batch request and returns the error of each call, in order.
+func (c *GoogleCalendarClient) sendBatch(calls []batchCall) []error {
+	errs := make([]error, len(calls))
+	fail := func(err error) []error {
+		for i := range errs {
+			errs[i] = err
+		}
+		return errs
+	}
+
+	basePath, err := url.Parse(c.Service.BasePath)
+	if err != nil {
+		return fail(fmt.Errorf("invalid calendar base path: %v", err))
+	}
+
+	// Step 1: Encode each call as an application/http part
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	for i, call := range calls {
+		var payload []byte
+		if call.Body != nil {
+			if payload, err = json.Marshal(call.Body); err != nil {
+				errs[i] = fmt.Errorf("error encoding request: %v", err)
+				continue
+			}
+		}
+
+		header := textproto.MIMEHeader{}
+		header.Set("Content-Type", "application/http")
+		header.Set("Content-ID", "<item-"+strconv.Itoa(i)+">")
+		part, err := writer.CreatePart(header)
+		if err != nil {
+			return fail(err)
+		}
+
+		fmt.Fprintf(part, "%s %s%s HTTP/1.1\r\n", call.Method, basePath.Path, call.Path)
+		if payload != nil {
+			fmt.Fprintf(part, "Content-Type: application/json\r\nContent-Length: %d\r\n\r\n", len(payload))
+			part.Write(payload)
+		} else {
+			fmt.Fprint(part, "\r\n")
+		}
+	}
+	writer.Close()
+
+	// Step 2: Send the batch request
+	req, err := http.NewRequest(http.MethodPost, c.BatchURL, &body)
+	if err != nil {
+		return fail(err)
+	}
+	req.Header.Set("Content-Type", "multipart/mixed; boundary="+writer.Boundary())
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return fail(fmt.Errorf("error sending batch request: %w", err))
+	}
+	defer resp.Body.Close()
+
+	if err := googleapi.CheckResponse(resp); err != nil {
+		return fail(err)
+	}
+
+	// Step 3: Match each part of the response to its call by Content-ID
+	_, params, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if err != nil || params["boundary"] == "" {
+		return fail(fmt.Errorf("invalid batch response content type: %s", resp.Header.Get("Content-Type")))
+	}
+	answered := make([]bool, len(calls))
+	for i := range calls {
+		answered[i] = errs[i] != nil // Calls that could not be encoded were not sent
+	}
+	reader := multipart.NewReader(resp.Body, params["boundary"])
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fail(fmt.Errorf("error reading batch response: %w", err))
+		}
+
+		contentID := strings.Trim(part.Header.Get("Content-ID"), "<>")
+		index, err := strconv.Atoi(strings.TrimPrefix(contentID, "response-item-"))
+		if err != nil || index < 0 || index >= len(calls) {
+			continue
+		}
+
+		itemResp, err := http.ReadResponse(bufio.NewReader(part), nil)
+		if err != nil {
+			errs[index] = fmt.Errorf("error reading batch response item: %w", err)
+		} else {
+			errs[index] = googleapi.CheckResponse(itemResp)
+			itemResp.Body.Close()
+		}
+		answered[index] = true
+	}
+
+	for i := range calls {
+		if !answered[i] {
+			errs[i] = fmt.Errorf("%w for batch item %d", errNoBatchResponse, i)
+		}
+	}
+	return errs
+}
@@ -0,0 +1,162 @@
+package scraper
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"funtech-scraper/scraper/calendartest"
+)
+
+const testCalendarID = "lessons"
+
+// startCalendar starts a fake Calendar API and returns a client for it.
+func startCalendar(t *testing.T) (*GoogleCalendarClient, *calendartest.Calendar) {
+	t.Helper()
+	srv, fake := calendartest.NewServer()
+	t.Cleanup(srv.Close)
+	client, err := NewGoogleCalendarClient(srv.Client(), srv.URL+calendartest.BasePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client, fake
+}
+
+// testEvent builds the managed event for the i-th lesson of a test plan.
+func testEvent(i int, summary string) CalendarEvent {
+	start := time.Date(2024, time.September, 23, 9, 0, 0, 0, time.UTC).Add(time.Duration(i) * time.Hour)
+	return CalendarEvent{
+		Key:     fmt.Sprintf("2024-25/1/1/2024-09-23/Monday/Course %d/0", i),
+		Summary: summary,
+		Start:   start,
+		End:     start.Add(time.Hour),
+		Managed: true,
+	}
+}
+
+// seedPlan adds existing events to the fake calendar and returns a plan that deletes 10 of them,
+// updates 10 and inserts 40 new events: 60 changes in all.
+func seedPlan(fake *calendartest.Calendar) *SyncPlan {
+	plan := &SyncPlan{}
+	for i := 0; i < 20; i++ {
+		event := testEvent(i, fmt.Sprintf("Course %d", i))
+		event.ID = fake.AddEvent(testCalendarID, toGoogleEvent(event)).Id
+		if i < 10 {
+			plan.Deletes = append(plan.Deletes, event)
+			continue
+		}
+		updated := testEvent(i, fmt.Sprintf("Course %d moved", i))
+		updated.ID = event.ID
+		plan.Updates = append(plan.Updates, EventUpdate{Old: event, New: updated})
+	}
+	for i := 20; i < 60; i++ {
+		plan.Inserts = append(plan.Inserts, testEvent(i, fmt.Sprintf("Course %d", i)))
+	}
+	return plan
+}
+
+// applyPlanUnbatched makes the changes in the plan with one API call each, as the sync did before
+// it batched its changes.
+func applyPlanUnbatched(client *GoogleCalendarClient, plan *SyncPlan) error {
+	for _, event := range plan.Deletes {
+		if err := client.Service.Events.Delete(testCalendarID, event.ID).Do(); err != nil {
+			return err
+		}
+	}
+	for _, update := range plan.Updates {
+		if _, err := client.Service.Events.Patch(testCalendarID, update.Old.ID, toGoogleEvent(update.New)).Do(); err != nil {
+			return err
+		}
+	}
+	for _, event := range plan.Inserts {
+		if _, err := client.Service.Events.Insert(testCalendarID, toGoogleEvent(event)).Do(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// summaries returns the sorted summaries of the events in the fake calendar.
+func summaries(fake *calendartest.Calendar) []string {
+	var names []string
+	for _, event := range fake.Events(testCalendarID) {
+		names = append(names, event.Summary)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestApplySyncPlanBatchesRequests(t *testing.T) {
+	unbatchedClient, unbatchedFake := startCalendar(t)
+	unbatchedPlan := seedPlan(unbatchedFake)
+	if err := applyPlanUnbatched(unbatchedClient, unbatchedPlan); err != nil {
+		t.Fatalf("applying plan without batching: %v", err)
+	}
+
+	batchedClient, batchedFake := startCalendar(t)
+	batchedPlan := seedPlan(batchedFake)
+	if err := ApplySyncPlan(batchedClient, testCalendarID, batchedPlan); err != nil {
+		t.Fatalf("ApplySyncPlan: %v", err)
+	}
+
+	if got := len(unbatchedFake.Requests()); got != 60 {
+		t.Errorf("without batching: %d requests, want one per change (60)", got)
+	}
+	requests := batchedFake.Requests()
+	if len(requests) != 2 {
+		t.Errorf("with batching: %d requests, want 2 batches of up to %d changes", len(requests), maxBatchSize)
+	}
+	for _, request := range requests {
+		if request != http.MethodPost+" /batch/calendar/v3" {
+			t.Errorf("with batching: unexpected request %q", request)
+		}
+	}
+
+	if got, want := summaries(batchedFake), summaries(unbatchedFake); !reflect.DeepEqual(got, want) {
+		t.Errorf("batched calendar = %q, want the same as unbatched %q", got, want)
+	}
+	if got := len(batchedFake.Events(testCalendarID)); got != 50 {
+		t.Errorf("calendar has %d events, want 50", got)
+	}
+}
+
+func TestApplySyncPlanRetriesFailedBatchItems(t *testing.T) {
+	tests := []struct {
+		name         string
+		failure      int
+		wantErr      bool
+		wantRequests int
+		wantEvents   int
+	}{
+		// The failed insert is sent again in a second batch on its own
+		{name: "retryable", failure: http.StatusServiceUnavailable, wantRequests: 2, wantEvents: 3},
+		// The failed insert is reported and the others are still made
+		{name: "not retryable", failure: http.StatusBadRequest, wantErr: true, wantRequests: 1, wantEvents: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, fake := startCalendar(t)
+			plan := &SyncPlan{Inserts: []CalendarEvent{
+				testEvent(0, "Course 0"), testEvent(1, "Course 1"), testEvent(2, "Course 2"),
+			}}
+
+			// Only the first call in the batch fails
+			fake.FailNext(tt.failure)
+			err := ApplySyncPlan(client, testCalendarID, plan)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ApplySyncPlan = %v, want error %v", err, tt.wantErr)
+			}
+
+			if got := len(fake.Requests()); got != tt.wantRequests {
+				t.Errorf("%d requests, want %d", got, tt.wantRequests)
+			}
+			if got := len(fake.Events(testCalendarID)); got != tt.wantEvents {
+				t.Errorf("calendar has %d events, want %d", got, tt.wantEvents)
+			}
+		})
+	}
+}
@@ -1,130 +1,152 @@
 package scraper
 
 import (
-	"crypto/md5"
-	"encoding/hex"
+	"errors"
 	"fmt"
+	"net/http"
+	"strings"
 	"time"
 
 	"google.golang.org/api/calendar/v3"
 	"google.golang.org/api/googleapi"
 )
 
-func AddLessonsToGoogleCalendar(service *calendar.Service, calendarID string, lessons []Lesson, clearAll bool) error {
-	if clearAll {
-		err := ClearCalendar(service, calendarID)
-		if err != nil {
-			return fmt.Errorf("error clearing Google Calendar: %v", err)
-		}
-	}
+const (
+	// sourceProperty is the private extended property that marks events created by the sync.
+	// Only events carrying it are ever updated or deleted.
+	sourceProperty = "ftcalendarSource"
+	sourceValue    = "funtech-sync"
+	// lessonKeyProperty is the private extended property that holds a managed event's lesson key.
+	lessonKeyProperty = "ftcalendarLessonKey"
+)
 
-	// Fetch all existing events from Google Calendar
-	existingEvents, err := GetAllEvents(service, calendarID)
-	if err != nil {
-		return fmt.Errorf("error fetching all events from Google Calendar: %v", err)
-	}
+// GoogleSink syncs lessons into a Google Calendar. Only events carrying the source marker are
+// ever updated or deleted, and updates only patch the fields the sync owns.
+type GoogleSink struct {
+	Client     *GoogleCalendarClient
+	CalendarID string
+	State      *SyncState // Events cached from the last sync; may be nil
+}
 
-	// Map to store existing Google Calendar events with their generated IDs
-	existingEventsMap := make(map[string]*calendar.Event)
-	for _, event := range existingEvents {
-		if event == nil || event.Status == "cancelled" {
-			continue
-		}
+// ListEvents lists the calendar's events, fetching only the changes since the last listing when
+// the sink has a sync state.
+func (s *GoogleSink) ListEvents(timeMin, timeMax time.Time) ([]CalendarEvent, error) {
+	return ListCalendarEvents(s.Client, s.CalendarID, timeMin, timeMax, s.State)
+}
 
-		if event.Start == nil || event.End == nil {
-			continue
-		}
+// ApplyPlan makes the changes in the plan to the calendar in batch requests.
+func (s *GoogleSink) ApplyPlan(plan *SyncPlan) error {
+	return ApplySyncPlan(s.Client, s.CalendarID, plan)
+}
 
-		// Generate an event ID for existing Google Calendar event
-		eventID := generateEventID(event.Summary, event.Start.DateTime, event.End.DateTime)
-		existingEventsMap[eventID] = event
-		fmt.Printf("Existing Google Event: ID: %s, Summary: %s, Start: %s, End: %s\n", eventID, event.Summary, event.Start.DateTime, event.End.DateTime)
+// ApplySyncPlan makes the changes in the plan to the calendar, sending them in batch requests.
+// Every change is attempted; failed changes are reported together once the others are made.
+func ApplySyncPlan(client *GoogleCalendarClient, calendarID string, plan *SyncPlan) error {
+	var calls []batchCall
+	for _, event := range plan.Deletes {
+		fmt.Printf("Deleting event '%s' (ID: %s)\n", event.Summary, event.ID)
+		call := deleteEventCall(calendarID, event.ID)
+		call.Description = fmt.Sprintf("deleting event '%s'", event.Summary)
+		calls = append(calls, call)
 	}
 
-	lessonsMap := make(map[string]*calendar.Event)
+	// Patch only the fields the sync owns so reminders and notes added by the tutor are kept
+	for _, update := range plan.Updates {
+		fmt.Printf("Updating event '%s' (Key: %s)\n", update.New.Summary, update.New.Key)
+		call := patchEventCall(calendarID, update.Old.ID, toGoogleEvent(update.New))
+		call.Description = fmt.Sprintf("updating event '%s'", update.New.Summary)
+		calls = append(calls, call)
+	}
 
-	fmt.Println("Lessons:")
-	for _, lesson := range lessons {
-		startDateTime, endDateTime, err := getEventTimes(lesson.Date, lesson.StartTime, lesson.EndTime)
-		if err != nil {
-			fmt.Printf("Error parsing event times: %v\n", err)
-			continue
-		}
+	for _, event := range plan.Inserts {
+		fmt.Printf("Inserting new event '%s' (Key: %s)\n", event.Summary, event.Key)
+		call := insertEventCall(calendarID, toGoogleEvent(event))
+		call.Description = fmt.Sprintf("inserting event '%s'", event.Summary)
+		calls = append(calls, call)
+	}
 
-		// Convert times to Europe/London timezone
-		loc, _ := time.LoadLocation("Europe/London")
-		start := startDateTime.In(loc)
-		end := endDateTime.In(loc)
+	if err := batchErrors(calls, client.runBatch(calls)); err != nil {
+		return fmt.Errorf("error syncing lessons with Google Calendar: %v", err)
+	}
 
-		fmt.Printf("Converted Start: %s, End: %s\n", start, end)
+	return nil
+}
 
-		// Ensure the end time is after the start time
-		if !end.After(start) {
-			end = start.Add(time.Hour) // Adjust end time to be one hour after start time
+// batchErrors combines the errors of failed calls into one error. Deleting an event that is
+// already gone counts as success.
+func batchErrors(calls []batchCall, errs []error) error {
+	var failures []string
+	for i, err := range errs {
+		if err == nil {
+			continue
 		}
-
-		summary := lesson.Course
-		startStr := start.Format(time.RFC3339)
-		endStr := end.Format(time.RFC3339)
-		eventID := generateEventID(summary, startStr, endStr)
-
-		colorID := getColorIDForLessonType(lesson.LessonType)
-
-		lessonsMap[eventID] = &calendar.Event{
-			Summary: summary,
-			Start: &calendar.EventDateTime{
-				DateTime: startStr,
-				TimeZone: "Europe/London",
-			},
-			End: &calendar.EventDateTime{
-				DateTime: endStr,
-				TimeZone: "Europe/London",
-			},
-			ColorId: colorID,
+		var gerr *googleapi.Error
+		if errors.As(err, &gerr) && calls[i].Method == http.MethodDelete &&
+			(gerr.Code == http.StatusNotFound || gerr.Code == http.StatusGone) {
+			fmt.Printf("Event already deleted from Google Calendar (%s).\n", calls[i].Description)
+			continue
 		}
-
-		fmt.Printf("Lesson: ID: %s, Summary: %s, Start: %s, End: %s\n", eventID, summary, startStr, endStr)
+		failures = append(failures, fmt.Sprintf("%s: %v", calls[i].Description, err))
 	}
 
-	// Delete events in Google Calendar that are not in the lessons data
-	for eventID, existingEvent := range existingEventsMap {
-		if _, found := lessonsMap[eventID]; !found {
-			fmt.Printf("Deleting event '%s' (ID: %s)\n", existingEvent.Summary, eventID)
-			err := service.Events.Delete(calendarID, existingEvent.Id).Do()
-			if err != nil {
-				return fmt.Errorf("error deleting event from Google Calendar: %v", err)
-			}
-		}
+	if len(failures) == 0 {
+		return nil
 	}
+	return fmt.Errorf("%d of %d changes failed: %s", len(failures), len(calls), strings.Join(failures, "; "))
+}
 
-	for eventID, gEvent := range lessonsMap {
-		if existingEvent, found := existingEventsMap[eventID]; found {
-			// Check if the event needs updating
-			if existingEvent.Summary != gEvent.Summary || existingEvent.Start.DateTime != gEvent.Start.DateTime || existingEvent.End.DateTime != gEvent.End.DateTime {
-				fmt.Printf("Updating event '%s' (ID: %s)\n", gEvent.Summary, eventID)
-				_, err = service.Events.Update(calendarID, existingEvent.Id, gEvent).Do()
-				if err != nil {
-					return fmt.Errorf("error updating event in Google Calendar: %v", err)
-				}
-			}
-		} else {
-			// Insert new event if not found in existing events
-			fmt.Printf("Inserting new event '%s' (ID: %s)\n", gEvent.Summary, eventID)
-			_, err = service.Events.Insert(calendarID, gEvent).Do()
-			if err != nil {
-				return fmt.Errorf("error inserting event into Google Calendar: %v", err)
-			}
-		}
+// toGoogleEvent builds the Google Calendar event for a managed event, tagged with its lesson key.
+func toGoogleEvent(event CalendarEvent) *calendar.Event {
+	// Convert times to Europe/London timezone
+	loc, _ := time.LoadLocation("Europe/London")
+	return &calendar.Event{
+		Summary: event.Summary,
+		Start: &calendar.EventDateTime{
+			DateTime: event.Start.In(loc).Format(time.RFC3339),
+			TimeZone: "Europe/London",
+		},
+		End: &calendar.EventDateTime{
+			DateTime: event.End.In(loc).Format(time.RFC3339),
+			TimeZone: "Europe/London",
+		},
+		ColorId: getColorIDForLessonType(event.LessonType),
+		ExtendedProperties: &calendar.EventExtendedProperties{
+			Private: map[string]string{
+				sourceProperty:    sourceValue,
+				lessonKeyProperty: event.Key,
+			},
+		},
 	}
-
-	fmt.Println("Lessons successfully synced with Google Calendar.")
-	return nil
 }
 
-func generateEventID(summary, start, end string) string {
-	hash := md5.New()
-	hash.Write([]byte(summary + start + end))
-	return hex.EncodeToString(hash.Sum(nil))
+// fromGoogleEvent converts a timed Google Calendar event. All-day events are never lessons and are skipped.
+func fromGoogleEvent(event *calendar.Event) (CalendarEvent, bool) {
+	if event.Start == nil || event.End == nil {
+		return CalendarEvent{}, false
+	}
+	start, err := time.Parse(time.RFC3339, event.Start.DateTime)
+	if err != nil {
+		return CalendarEvent{}, false
+	}
+	end, err := time.Parse(time.RFC3339, event.End.DateTime)
+	if err != nil {
+		return CalendarEvent{}, false
+	}
+
+	calendarEvent := CalendarEvent{
+		ID:         event.Id,
+		Summary:    event.Summary,
+		Start:      start,
+		End:        end,
+		LessonType: getLessonTypeForColorID(event.ColorId),
+	}
+	if event.ExtendedProperties != nil {
+		private := event.ExtendedProperties.Private
+		calendarEvent.Key = private[lessonKeyProperty]
+		// Events created before the source marker was introduced only carry a lesson key
+		calendarEvent.Managed = private[sourceProperty] == sourceValue || calendarEvent.Key != ""
+	}
+	return calendarEvent, true
 }
 
 func getColorIDForLessonType(lessonType int) string {
@@ -140,57 +162,16 @@ func getColorIDForLessonType(lessonType int) string {
 	}
 }
 
-// ClearCalendar deletes all events from the specified Google Calendar.
-func ClearCalendar(service *calendar.Service, calendarID string) error {
-	pageToken := ""
-	for {
-		events, err := service.Events.List(calendarID).PageToken(pageToken).Do()
-		if err != nil {
-			return fmt.Errorf("error fetching events from Google Calendar: %v", err)
-		}
-
-		for _, event := range events.Items {
-			if event == nil || event.Status == "cancelled" {
-				continue
-			}
-			err = service.Events.Delete(calendarID, event.Id).Do()
-			if err != nil {
-				if gerr, ok := err.(*googleapi.Error); ok && gerr.Code == 410 {
-					fmt.Printf("Event '%s' (ID: %s) already deleted from Google Calendar.\n", event.Summary, event.Id)
-					continue
-				}
-				return fmt.Errorf("error deleting event from Google Calendar: %v", err)
-			}
-			fmt.Printf("Event '%s' (ID: %s) removed from Google Calendar.\n", event.Summary, event.Id)
-		}
-
-		pageToken = events.NextPageToken
-		if pageToken == "" {
-			break
-		}
-	}
-
-	fmt.Println("All events cleared from Google Calendar.")
-	return nil
-}
-
-// GetAllEvents retrieves all events from the specified Google Calendar.
-func GetAllEvents(service *calendar.Service, calendarID string) ([]*calendar.Event, error) {
-	var allEvents []*calendar.Event
-	pageToken := ""
-	for {
-		events, err := service.Events.List(calendarID).PageToken(pageToken).Do()
-		if err != nil {
-			return nil, fmt.Errorf("error fetching events from Google Calendar: %v", err)
-		}
-		allEvents = append(allEvents, events.Items...)
-		fmt.Printf("Fetched %d events from Google Calendar\n", len(events.Items))
-
-		pageToken = events.NextPageToken
-		if pageToken == "" {
-			break
-		}
+// getLessonTypeForColorID is the inverse of getColorIDForLessonType.
+func getLessonTypeForColorID(colorID string) int {
+	switch colorID {
+	case "9":
+		return 1
+	case "5":
+		return 2
+	case "11":
+		return 3
+	default:
+		return 0
 	}
-	fmt.Printf("Total events fetched: %d\n", len(allEvents))
-	return allEvents, nil
 }
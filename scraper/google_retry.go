@@ -0,0 +1,122 @@
+package scraper
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"syscall"
+	"time"
+
+	"google.golang.org/api/googleapi"
+)
+
+const (
+	maxGoogleAttempts = 5                // Attempts per Calendar API call before giving up
+	baseRetryDelay    = 1 * time.Second  // Delay before the first retry, doubled after each attempt
+	maxRetryDelay     = 60 * time.Second // Upper bound on the delay between attempts
+)
+
+// errNoBatchResponse is the error of a call that a batch response did not answer.
+var errNoBatchResponse = errors.New("no response")
+
+// IsRetryableGoogleError reports whether a failed Calendar API call is worth retrying: rate limit
+// errors, server errors, timeouts, dropped connections and calls missing from a batch response. Any other error,
+// such as a token Google rejected, fails the same way again.
+func IsRetryableGoogleError(err error) bool {
+	var authErr *GoogleAuthError
+	if errors.As(err, &authErr) {
+		return false
+	}
+
+	var gerr *googleapi.Error
+	if !errors.As(err, &gerr) {
+		return isConnectionError(err) || errors.Is(err, errNoBatchResponse)
+	}
+	if gerr.Code == http.StatusTooManyRequests || gerr.Code >= 500 {
+		return true
+	}
+	if gerr.Code == http.StatusForbidden {
+		for _, item := range gerr.Errors {
+			if item.Reason == "rateLimitExceeded" || item.Reason == "userRateLimitExceeded" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// isConnectionError reports whether err is a timeout or a failure to connect to or talk to the
+// server, which may not happen again. Other errors from the HTTP client, such as an untrusted TLS
+// certificate, a bad URL or a token endpoint refusing the request, are not.
+func isConnectionError(err error) bool {
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && (opErr.Op == "dial" || opErr.Op == "read" || opErr.Op == "write") {
+		return true
+	}
+	// The server closed the connection before answering
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) && errors.Is(urlErr.Err, io.EOF) {
+		return true
+	}
+	return errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// RetryDelay returns how long to wait before the given retry attempt (starting at 1). It honours
+// a Retry-After header on the error, and otherwise backs off exponentially with jitter so that
+// users synced together do not retry in lockstep.
+func RetryDelay(err error, attempt int) time.Duration {
+	var gerr *googleapi.Error
+	if errors.As(err, &gerr) && gerr.Header != nil {
+		if retryAfter := gerr.Header.Get("Retry-After"); retryAfter != "" {
+			if seconds, err := strconv.Atoi(retryAfter); err == nil && seconds >= 0 {
+				return capDelay(time.Duration(seconds) * time.Second)
+			}
+			if at, err := http.ParseTime(retryAfter); err == nil {
+				return capDelay(time.Until(at))
+			}
+		}
+	}
+
+	delay := baseRetryDelay
+	for i := 1; i < attempt && delay < maxRetryDelay; i++ {
+		delay *= 2
+	}
+	delay = capDelay(delay)
+	// Wait between half and all of the delay
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+func capDelay(delay time.Duration) time.Duration {
+	if delay < 0 {
+		return 0
+	}
+	if delay > maxRetryDelay {
+		return maxRetryDelay
+	}
+	return delay
+}
+
+// withRetry runs a Calendar API call, retrying it with backoff while it fails with a retryable error.
+func withRetry(description string, call func() error) error {
+	var err error
+	for attempt := 1; attempt <= maxGoogleAttempts; attempt++ {
+		if err = call(); err == nil || !IsRetryableGoogleError(err) {
+			return err
+		}
+		if attempt < maxGoogleAttempts {
+			delay := RetryDelay(err, attempt)
+			fmt.Printf("Error %s, retrying in %v: %v\n", description, delay.Round(time.Millisecond), err)
+			time.Sleep(delay)
+		}
+	}
+	return err
+}
@@ -0,0 +1,61 @@
+package scraper
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"syscall"
+	"testing"
+
+	"golang.org/x/oauth2"
+	"google.golang.org/api/googleapi"
+)
+
+// timeoutError is a network error that timed out.
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestIsRetryableGoogleError(t *testing.T) {
+	rateLimited := &googleapi.Error{Code: http.StatusForbidden, Errors: []googleapi.ErrorItem{{Reason: "rateLimitExceeded"}}}
+	authErr := &GoogleAuthError{Username: "alice", Reason: "access was revoked or has expired"}
+
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"too many requests", &googleapi.Error{Code: http.StatusTooManyRequests}, true},
+		{"server error", &googleapi.Error{Code: http.StatusServiceUnavailable}, true},
+		{"rate limit", rateLimited, true},
+		{"forbidden", &googleapi.Error{Code: http.StatusForbidden}, false},
+		{"not found", &googleapi.Error{Code: http.StatusNotFound}, false},
+		{"wrapped server error", fmt.Errorf("error fetching events: %w", &googleapi.Error{Code: http.StatusBadGateway}), true},
+		{"connection closed", &url.Error{Op: "Post", URL: "https://example.com", Err: io.EOF}, true},
+		{"connection refused", &url.Error{Op: "Post", URL: "https://example.com", Err: &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}}, true},
+		{"connection reset", &url.Error{Op: "Post", URL: "https://example.com", Err: &net.OpError{Op: "read", Net: "tcp", Err: syscall.ECONNRESET}}, true},
+		{"timeout", &url.Error{Op: "Post", URL: "https://example.com", Err: timeoutError{}}, true},
+		{"untrusted certificate", &url.Error{Op: "Post", URL: "https://example.com", Err: x509.UnknownAuthorityError{}}, false},
+		{"certificate verification", &url.Error{Op: "Post", URL: "https://example.com", Err: &tls.CertificateVerificationError{Err: x509.UnknownAuthorityError{}}}, false},
+		{"TLS alert", &url.Error{Op: "Post", URL: "https://example.com", Err: &net.OpError{Op: "remote error", Err: errors.New("tls: bad certificate")}}, false},
+		{"bad URL", &url.Error{Op: "Post", URL: "example.com", Err: errors.New("unsupported protocol scheme")}, false},
+		{"token endpoint error", &url.Error{Op: "Post", URL: "https://example.com", Err: &oauth2.RetrieveError{ErrorCode: "invalid_client"}}, false},
+		{"unexpected EOF", fmt.Errorf("error reading batch response: %w", io.ErrUnexpectedEOF), true},
+		{"missing batch response", fmt.Errorf("%w for batch item %d", errNoBatchResponse, 3), true},
+		{"token rejected", &url.Error{Op: "Get", URL: "https://example.com", Err: authErr}, false},
+		{"encoding error", errors.New("error encoding request: unsupported value"), false},
+	}
+
+	for _, tt := range tests {
+		if got := IsRetryableGoogleError(tt.err); got != tt.want {
+			t.Errorf("%s: IsRetryableGoogleError(%v) = %v, want %v", tt.name, tt.err, got, tt.want)
+		}
+	}
+}
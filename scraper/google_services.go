@@ -2,6 +2,7 @@ package scraper
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
@@ -18,7 +19,22 @@ var (
 	oauthConfig *oauth2.Config
 )
 
-func getClient(oauth2Config *oauth2.Config, userCfg *config.UserConfig, getAuthCode func(string) (string, bool), saveUserConfig func(string, *config.UserConfig) error) (*http.Client, error) {
+// GoogleAuthError is returned when Google no longer accepts the user's saved token, because access
+// was revoked or the user never authorised the site. Retrying does not help: the user must authorise
+// the site again.
+type GoogleAuthError struct {
+	Username string
+	Reason   string
+}
+
+func (e *GoogleAuthError) Error() string {
+	return fmt.Sprintf("Google authorization needed for user %s: %s", e.Username, e.Reason)
+}
+
+// getClient returns an HTTP client authorised with the user's saved token, refreshing it if it has
+// expired, and saves refreshed tokens to the user's entry in users. Codes are exchanged for tokens by
+// the web server, so a token that cannot be refreshed returns a *GoogleAuthError.
+func getClient(oauth2Config *oauth2.Config, users config.UserStore, username string, userCfg *config.UserConfig) (*http.Client, error) {
 	token := &oauth2.Token{
 		AccessToken:  userCfg.AccessToken,
 		TokenType:    userCfg.TokenType,
@@ -26,45 +42,40 @@ func getClient(oauth2Config *oauth2.Config, userCfg *config.UserConfig, getAuthC
 	}
 	token.Expiry, _ = time.Parse(time.RFC3339, userCfg.Expiry)
 
+	// Tokens refreshed while the client is in use are saved too
+	tokSource := newSavingTokenSource(oauth2Config.TokenSource(context.Background(), token), users, username, userCfg, token)
 	if token.Valid() {
-		log.Printf("Token is still valid for user: %s", userCfg.Username)
-		return oauth2Config.Client(context.Background(), token), nil
+		log.Printf("Token is still valid for user: %s", username)
+		return oauth2.NewClient(context.Background(), tokSource), nil
+	}
+	if token.RefreshToken == "" {
+		log.Printf("No refresh token for user: %s", username)
+		return nil, &GoogleAuthError{Username: username, Reason: "no refresh token saved"}
 	}
 
-	tokSource := oauth2Config.TokenSource(context.Background(), token)
-	newToken, err := tokSource.Token()
-	if err != nil || !newToken.Valid() {
-		log.Printf("Token invalid for user: %s, requesting new token...", userCfg.Username)
-		code, ok := getAuthCode(userCfg.Username)
-		if !ok {
-			log.Printf("Authorization code not found for user: %s", userCfg.Username)
-			return nil, fmt.Errorf("authorization code not found for user: %s", userCfg.Username)
-		}
-
-		newToken, err = oauth2Config.Exchange(context.Background(), code)
-		if err != nil {
-			log.Printf("Unable to retrieve token from web for user: %s, error: %v", userCfg.Username, err)
-			return nil, fmt.Errorf("unable to retrieve token from web: %v", err)
-		}
-
-		log.Printf("New token retrieved for user: %s", userCfg.Username)
-		// Update the user config ONLY if the token retrieval was successful
-		userCfg.AccessToken = newToken.AccessToken
-		userCfg.TokenType = newToken.TokenType
-		userCfg.RefreshToken = newToken.RefreshToken
-		userCfg.Expiry = newToken.Expiry.Format(time.RFC3339)
-
-		// Save the updated user configuration
-		if err := saveUserConfig(userCfg.Username, userCfg); err != nil {
-			log.Printf("Unable to save user config for user: %s, error: %v", userCfg.Username, err)
-			return nil, fmt.Errorf("unable to save user config: %v", err)
-		}
-		log.Printf("User config saved successfully for user: %s", userCfg.Username)
-	} else {
-		log.Printf("Token refreshed for user: %s", userCfg.Username)
+	if _, err := tokSource.Token(); err != nil {
+		log.Printf("Unable to refresh token for user: %s, error: %v", username, err)
+		return nil, err
 	}
+	log.Printf("Token refreshed for user: %s", username)
 
-	return oauth2Config.Client(context.Background(), newToken), nil
+	return oauth2.NewClient(context.Background(), tokSource), nil
+}
+
+// refreshError turns a failed token refresh into a *GoogleAuthError when Google rejected the refresh
+// token itself, rather than failing for a reason worth retrying.
+func refreshError(username string, err error) error {
+	var retrieveErr *oauth2.RetrieveError
+	if !errors.As(err, &retrieveErr) {
+		return err
+	}
+	if retrieveErr.ErrorCode == "invalid_grant" {
+		return &GoogleAuthError{Username: username, Reason: "access was revoked or has expired"}
+	}
+	if retrieveErr.Response != nil && retrieveErr.Response.StatusCode == http.StatusUnauthorized {
+		return &GoogleAuthError{Username: username, Reason: "token refresh was unauthorized"}
+	}
+	return err
 }
 
 // getConfig sets up the OAuth2 configuration for the Google Calendar API.
@@ -78,41 +89,64 @@ func getConfig(cfg *config.CommonConfig) *oauth2.Config {
 	}
 }
 
-// GetCalendarService retrieves the Google Calendar service for the user, managing token exchange or refresh as needed.
-func GetCalendarService(commonCfg *config.CommonConfig, userCfg *config.UserConfig, getAuthCode func(string) (string, bool), saveUserConfig func(string, *config.UserConfig) error) (*calendar.Service, error) {
+// GetCalendarService retrieves the Google Calendar service for the user, refreshing the token as needed
+// and saving it to the user's entry in users.
+func GetCalendarService(commonCfg *config.CommonConfig, users config.UserStore, username string, userCfg *config.UserConfig) (*calendar.Service, error) {
+	client, err := GetCalendarClient(commonCfg, users, username, userCfg)
+	if err != nil {
+		return nil, err
+	}
+	return client.Service, nil
+}
+
+// GetCalendarClient is like GetCalendarService but also keeps the authorised HTTP client, which
+// the sync needs to send batch requests. It returns a *GoogleAuthError when the user must authorise
+// the site again.
+func GetCalendarClient(commonCfg *config.CommonConfig, users config.UserStore, username string, userCfg *config.UserConfig) (*GoogleCalendarClient, error) {
 	if oauthConfig == nil {
 		oauthConfig = getConfig(commonCfg)
 	}
 
-	client, err := getClient(oauthConfig, userCfg, getAuthCode, saveUserConfig)
+	client, err := getClient(oauthConfig, users, username, userCfg)
+	var authErr *GoogleAuthError
+	if errors.As(err, &authErr) {
+		return nil, authErr
+	}
 	if err != nil {
-		return nil, fmt.Errorf("authorization failed for user: %s", userCfg.Username)
+		return nil, fmt.Errorf("authorization failed for user %s: %v", username, err)
 	}
-	srv, err := calendar.New(client)
+	calendarClient, err := NewGoogleCalendarClient(client, "")
 	if err != nil {
-		return nil, fmt.Errorf("unable to retrieve Calendar client: %v", err)
+		return nil, err
 	}
 	fmt.Println("Google Calendar client retrieved successfully.")
-	return srv, nil
+	return calendarClient, nil
 }
 
 // NeedsGoogleAuth checks if a new Google authorization is required for the user.
-func NeedsGoogleAuth(userCfg *config.UserConfig, commonCfg *config.CommonConfig) (string, bool) {
-	if oauthConfig == nil {
-		oauthConfig = getConfig(commonCfg)
-	}
-
+func NeedsGoogleAuth(userCfg *config.UserConfig) bool {
 	expiry, err := time.Parse(time.RFC3339, userCfg.Expiry)
-	if err != nil || userCfg.AccessToken == "" || expiry.Before(time.Now()) {
-		authURL := oauthConfig.AuthCodeURL(userCfg.Username, oauth2.AccessTypeOffline, oauth2.ApprovalForce)
-		return authURL, true
+	return err != nil || userCfg.AccessToken == "" || expiry.Before(time.Now())
+}
+
+// SetUserToken stores a Google token in the user config, keeping the previous refresh token if the
+// new token has none. It does not save the config.
+func SetUserToken(userCfg *config.UserConfig, token *oauth2.Token) {
+	userCfg.AccessToken = token.AccessToken
+	userCfg.TokenType = token.TokenType
+	if token.RefreshToken != "" {
+		userCfg.RefreshToken = token.RefreshToken
 	}
-	return "", false
+	userCfg.Expiry = token.Expiry.Format(time.RFC3339)
 }
 
 // GetUserCalendars retrieves the list of calendars the user has access to.
 func GetUserCalendars(service *calendar.Service) ([]*calendar.CalendarListEntry, error) {
-	calendarList, err := service.CalendarList.List().Do()
+	var calendarList *calendar.CalendarList
+	err := withRetry("listing Google calendars", func() (err error) {
+		calendarList, err = service.CalendarList.List().Do()
+		return err
+	})
 	if err != nil {
 		return nil, err
 	}
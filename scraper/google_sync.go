@@ -0,0 +1,146 @@
+package scraper
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"google.golang.org/api/calendar/v3"
+	"google.golang.org/api/googleapi"
+)
+
+// SyncState caches a user's calendar events between syncs so only events changed since the last
+// listing need to be fetched. It is tied to the calendar and time window it was listed with.
+type SyncState struct {
+	CalendarID string                   `json:"calendar_id"`
+	TimeMin    time.Time                `json:"time_min"`
+	TimeMax    time.Time                `json:"time_max"`
+	SyncToken  string                   `json:"sync_token"`
+	Events     map[string]CalendarEvent `json:"events"` // Timed events in the window, by event ID
+}
+
+// ScrapeWindow returns the period covered by the scraped weeks, from the start of the first week to
+// the end of the last. Both times are zero if no week has a valid start date.
+func ScrapeWindow(results []ScrapeResult) (time.Time, time.Time) {
+	loc, _ := time.LoadLocation("Europe/London")
+	var timeMin, timeMax time.Time
+	for _, result := range results {
+		start, err := time.ParseInLocation("02/01/2006", result.Week.StartDate, loc)
+		if err != nil {
+			continue
+		}
+		end := start.AddDate(0, 0, 7)
+		if timeMin.IsZero() || start.Before(timeMin) {
+			timeMin = start
+		}
+		if end.After(timeMax) {
+			timeMax = end
+		}
+	}
+	return timeMin, timeMax
+}
+
+// ListCalendarEvents returns the timed events of the calendar between timeMin and timeMax. With a
+// sync state from an earlier listing of the same calendar and window, only the changes since then
+// are fetched; otherwise, or when Google has expired the sync token, the whole window is listed.
+// The state is updated on success and left unchanged on error.
+func ListCalendarEvents(client *GoogleCalendarClient, calendarID string, timeMin, timeMax time.Time, state *SyncState) ([]CalendarEvent, error) {
+	if state == nil {
+		state = &SyncState{}
+	}
+
+	if state.SyncToken != "" && state.CalendarID == calendarID && state.TimeMin.Equal(timeMin) && state.TimeMax.Equal(timeMax) {
+		events, err := listChangedEvents(client, state)
+		if err == nil {
+			return events, nil
+		}
+		var gerr *googleapi.Error
+		if !errors.As(err, &gerr) || gerr.Code != http.StatusGone {
+			return nil, err
+		}
+		fmt.Println("Sync token expired, listing all events from Google Calendar.")
+	}
+
+	fresh := &SyncState{CalendarID: calendarID, TimeMin: timeMin, TimeMax: timeMax, Events: make(map[string]CalendarEvent)}
+	call := client.Service.Events.List(calendarID)
+	if !timeMin.IsZero() {
+		call = call.TimeMin(timeMin.Format(time.RFC3339)).TimeMax(timeMax.Format(time.RFC3339))
+	}
+	syncToken, err := listEventPages(call, fresh)
+	if err != nil {
+		return nil, err
+	}
+	fresh.SyncToken = syncToken
+	fmt.Printf("Total events fetched: %d\n", len(fresh.Events))
+
+	*state = *fresh
+	return state.list(), nil
+}
+
+// listChangedEvents applies the changes since the state's sync token to a copy of its events.
+func listChangedEvents(client *GoogleCalendarClient, state *SyncState) ([]CalendarEvent, error) {
+	changed := &SyncState{Events: make(map[string]CalendarEvent, len(state.Events))}
+	for id, event := range state.Events {
+		changed.Events[id] = event
+	}
+
+	// Time bounds cannot be combined with a sync token, so events changed outside the window are dropped below
+	syncToken, err := listEventPages(client.Service.Events.List(state.CalendarID).SyncToken(state.SyncToken), changed)
+	if err != nil {
+		return nil, err
+	}
+	for id, event := range changed.Events {
+		if !state.TimeMin.IsZero() && (!event.End.After(state.TimeMin) || !event.Start.Before(state.TimeMax)) {
+			delete(changed.Events, id)
+		}
+	}
+	fmt.Printf("Events in Google Calendar after incremental sync: %d\n", len(changed.Events))
+
+	state.Events = changed.Events
+	state.SyncToken = syncToken
+	return state.list(), nil
+}
+
+// listEventPages pages through an events listing, merging the events into the state, and returns
+// the sync token for the next incremental listing.
+func listEventPages(call *calendar.EventsListCall, state *SyncState) (string, error) {
+	pageToken := ""
+	for {
+		var events *calendar.Events
+		err := withRetry("listing Google Calendar events", func() (err error) {
+			events, err = call.PageToken(pageToken).Do()
+			return err
+		})
+		if err != nil {
+			return "", err
+		}
+		fmt.Printf("Fetched %d events from Google Calendar\n", len(events.Items))
+
+		for _, event := range events.Items {
+			if event == nil {
+				continue
+			}
+			calendarEvent, ok := fromGoogleEvent(event)
+			if event.Status == "cancelled" || !ok {
+				delete(state.Events, event.Id)
+				continue
+			}
+			state.Events[event.Id] = calendarEvent
+		}
+
+		pageToken = events.NextPageToken
+		if pageToken == "" {
+			return events.NextSyncToken, nil
+		}
+	}
+}
+
+// list returns the cached events.
+func (s *SyncState) list() []CalendarEvent {
+	events := make([]CalendarEvent, 0, len(s.Events))
+	for _, key := range sortedKeys(s.Events) {
+		events = append(events, s.Events[key])
+	}
+	return events
+}
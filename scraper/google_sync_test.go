@@ -0,0 +1,110 @@
+package scraper
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+// eventSummaries returns the sorted summaries of the events.
+func eventSummaries(events []CalendarEvent) []string {
+	var names []string
+	for _, event := range events {
+		names = append(names, event.Summary)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestListCalendarEvents(t *testing.T) {
+	timeMin := time.Date(2024, time.September, 23, 0, 0, 0, 0, time.UTC)
+	timeMax := timeMin.AddDate(0, 0, 7)
+
+	tests := []struct {
+		name       string
+		expire     bool      // Google expires the sync token before the second listing
+		timeMax    time.Time // Window of the second listing
+		wantCached bool      // Whether the second listing reuses the cached events
+		wantCalls  int       // Listing requests made by the second listing
+	}{
+		{name: "changes since the last listing", timeMax: timeMax, wantCached: true, wantCalls: 1},
+		{name: "sync token expired", expire: true, timeMax: timeMax, wantCalls: 2},
+		{name: "window changed", timeMax: timeMax.AddDate(0, 0, 7), wantCalls: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, fake := startCalendar(t)
+			var seeded []CalendarEvent
+			for i := 0; i < 3; i++ {
+				event := testEvent(i, fmt.Sprintf("Course %c", 'A'+i))
+				event.ID = fake.AddEvent(testCalendarID, toGoogleEvent(event)).Id
+				seeded = append(seeded, event)
+			}
+
+			state := &SyncState{}
+			events, err := ListCalendarEvents(client, testCalendarID, timeMin, timeMax, state)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, want := eventSummaries(events), []string{"Course A", "Course B", "Course C"}; !reflect.DeepEqual(got, want) {
+				t.Fatalf("first listing = %q, want %q", got, want)
+			}
+			if state.SyncToken == "" {
+				t.Fatal("first listing saved no sync token")
+			}
+			firstToken := state.SyncToken
+
+			// An event only in the cache shows whether the second listing started from the cache
+			cachedOnly := testEvent(5, "Cached only")
+			cachedOnly.ID = "cached-only"
+			state.Events[cachedOnly.ID] = cachedOnly
+
+			// Delete one event, move another and add one inside and one outside the window
+			moved := testEvent(1, "Course B moved")
+			moved.ID = seeded[1].ID
+			later := testEvent(3, "Course D")
+			later.Start, later.End = later.Start.AddDate(0, 0, 7), later.End.AddDate(0, 0, 7)
+			plan := &SyncPlan{
+				Deletes: []CalendarEvent{seeded[0]},
+				Updates: []EventUpdate{{Old: seeded[1], New: moved}},
+				Inserts: []CalendarEvent{testEvent(4, "Course E"), later},
+			}
+			if err := ApplySyncPlan(client, testCalendarID, plan); err != nil {
+				t.Fatal(err)
+			}
+			if tt.expire {
+				fake.ExpireSyncTokens()
+			}
+
+			fake.ResetRequests()
+			events, err = ListCalendarEvents(client, testCalendarID, timeMin, tt.timeMax, state)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			want := []string{"Course B moved", "Course C", "Course E"}
+			if tt.timeMax.After(timeMax) {
+				want = append(want, "Course D")
+			}
+			if tt.wantCached {
+				want = append(want, "Cached only")
+			}
+			sort.Strings(want)
+			if got := eventSummaries(events); !reflect.DeepEqual(got, want) {
+				t.Errorf("second listing = %q, want %q", got, want)
+			}
+			if calls := len(fake.Requests()); calls != tt.wantCalls {
+				t.Errorf("second listing made %d requests, want %d", calls, tt.wantCalls)
+			}
+			if state.SyncToken == "" || state.SyncToken == firstToken {
+				t.Errorf("sync token = %q after the second listing, want a new one", state.SyncToken)
+			}
+			if len(state.Events) != len(want) || !state.TimeMax.Equal(tt.timeMax) {
+				t.Errorf("state has %d events up to %v, want %d up to %v", len(state.Events), state.TimeMax, len(want), tt.timeMax)
+			}
+		})
+	}
+}
@@ -0,0 +1,56 @@
+package scraper
+
+import (
+	"log"
+	"sync"
+
+	"funtech-scraper/config"
+
+	"golang.org/x/oauth2"
+)
+
+// savingTokenSource saves every new token from its source to the user config, so refreshed access
+// tokens, and refresh tokens Google rotates, survive a restart.
+type savingTokenSource struct {
+	source   oauth2.TokenSource
+	users    config.UserStore
+	username string // Name of the user in users
+	userCfg  *config.UserConfig
+
+	mu        sync.Mutex
+	lastSaved string // Access token last saved
+}
+
+// newSavingTokenSource wraps source, which starts from the token already saved for the user in users.
+func newSavingTokenSource(source oauth2.TokenSource, users config.UserStore, username string, userCfg *config.UserConfig, token *oauth2.Token) *savingTokenSource {
+	return &savingTokenSource{source: source, users: users, username: username, userCfg: userCfg, lastSaved: token.AccessToken}
+}
+
+// Token returns a valid token, saving it first if it is new. A token that cannot be saved is still
+// returned, as it is valid for now. A refresh token Google rejects gives a *GoogleAuthError.
+func (s *savingTokenSource) Token() (*oauth2.Token, error) {
+	token, err := s.source.Token()
+	if err != nil {
+		return nil, refreshError(s.username, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if token.AccessToken == s.lastSaved {
+		return token, nil
+	}
+
+	// Only the token is written, so changes the other process made to the config are kept
+	_, err = s.users.Update(s.username, func(stored *config.UserConfig) error {
+		SetUserToken(stored, token)
+		return nil
+	})
+	if err != nil {
+		log.Printf("Unable to save refreshed token for user: %s, error: %v", s.username, err)
+		return token, nil
+	}
+	SetUserToken(s.userCfg, token)
+	s.lastSaved = token.AccessToken
+	log.Printf("Refreshed token saved for user: %s", s.username)
+	return token, nil
+}
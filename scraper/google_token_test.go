@@ -0,0 +1,36 @@
+package scraper
+
+import (
+	"testing"
+	"time"
+
+	"funtech-scraper/config"
+
+	"golang.org/x/oauth2"
+)
+
+func TestSavingTokenSourceSavesUnderAccountName(t *testing.T) {
+	users := config.NewJSONDirStore(t.TempDir())
+	// The FunTech login can be changed on the dashboard, so it differs from the account name
+	userCfg := &config.UserConfig{Username: "alice.funtech", AccessToken: "old"}
+	if err := users.Put("alice", userCfg); err != nil {
+		t.Fatal(err)
+	}
+
+	refreshed := &oauth2.Token{AccessToken: "new", RefreshToken: "refresh", Expiry: time.Now().Add(time.Hour)}
+	source := newSavingTokenSource(oauth2.StaticTokenSource(refreshed), users, "alice", userCfg, &oauth2.Token{AccessToken: "old"})
+	if _, err := source.Token(); err != nil {
+		t.Fatalf("Token: %v", err)
+	}
+
+	saved, err := users.Get("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved.AccessToken != "new" || saved.RefreshToken != "refresh" {
+		t.Errorf("saved tokens = %q, %q, want the refreshed ones", saved.AccessToken, saved.RefreshToken)
+	}
+	if _, err := users.Get("alice.funtech"); err != config.ErrUserNotFound {
+		t.Errorf("Get(alice.funtech) = %v, want no user saved under the FunTech login", err)
+	}
+}
@@ -0,0 +1,172 @@
+package scraper
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+const (
+	usernameField = "data[Tutor][username]"
+	passwordField = "data[Tutor][password]"
+)
+
+// HTTPClient is a PortalClient that talks to the portal with plain HTTP requests and a
+// cookie jar. The portal renders its pages server-side, so no browser is needed.
+type HTTPClient struct {
+	client  *http.Client
+	baseURL string
+}
+
+// NewHTTPClient creates a PortalClient that uses net/http to talk to the portal.
+// An empty baseURL targets the live FunTech portal.
+func NewHTTPClient(baseURL string) *HTTPClient {
+	return &HTTPClient{
+		client:  &http.Client{Timeout: 30 * time.Second},
+		baseURL: portalURL(baseURL),
+	}
+}
+
+// Login submits the portal's login form in a fresh session and keeps the session cookies.
+func (c *HTTPClient) Login(username, password string) error {
+	// Step 1: Start a new session with an empty cookie jar
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return fmt.Errorf("could not create cookie jar: %v", err)
+	}
+	c.client.Jar = jar
+
+	// Step 2: Load the login page to pick up the session cookie and the form's hidden fields
+	loginURL := c.baseURL + loginPath
+	resp, err := c.client.Get(loginURL)
+	if err != nil {
+		return fmt.Errorf("could not load login page: %v", err)
+	}
+	doc, err := readDocument(resp)
+	if err != nil {
+		return fmt.Errorf("could not read login page: %v", err)
+	}
+
+	form := doc.Find("form").FilterFunction(func(_ int, s *goquery.Selection) bool {
+		return s.Find("input[name='"+usernameField+"']").Length() > 0
+	}).First()
+	if form.Length() == 0 {
+		return fmt.Errorf("login form not found on %s", loginURL)
+	}
+
+	// Step 3: Fill the login form and submit it
+	values := url.Values{}
+	form.Find("input[name]").Each(func(_ int, input *goquery.Selection) {
+		name, _ := input.Attr("name")
+		inputType := strings.ToLower(input.AttrOr("type", "text"))
+		if (inputType == "checkbox" || inputType == "radio") && input.AttrOr("checked", "") == "" {
+			return
+		}
+		values.Add(name, input.AttrOr("value", ""))
+	})
+	values.Set(usernameField, username)
+	values.Set(passwordField, password)
+
+	actionURL, err := resp.Request.URL.Parse(form.AttrOr("action", loginPath))
+	if err != nil {
+		return fmt.Errorf("invalid login form action: %v", err)
+	}
+	resp, err = c.client.PostForm(actionURL.String(), values)
+	if err != nil {
+		return fmt.Errorf("could not submit login form: %v", err)
+	}
+	doc, err = readDocument(resp)
+	if err != nil {
+		return fmt.Errorf("could not read login response: %v", err)
+	}
+
+	// Step 4: The portal shows the login form again when the credentials are rejected
+	if isLoginPage(doc) {
+		return fmt.Errorf("login rejected for user %s", username)
+	}
+	return nil
+}
+
+// FetchAvailability returns the availability overview page.
+func (c *HTTPClient) FetchAvailability() (string, error) {
+	return c.fetch(availabilityPath)
+}
+
+// FetchTerm returns a term's availability page.
+func (c *HTTPClient) FetchTerm(termPath string) (string, error) {
+	return c.fetch(termPath)
+}
+
+// FetchWeekAvailability returns a week's availability page.
+func (c *HTTPClient) FetchWeekAvailability(weekPath string) (string, error) {
+	return c.fetch(weekPath)
+}
+
+// FetchWeekSchedule returns the timetable page for a week of a term.
+func (c *HTTPClient) FetchWeekSchedule(year string, term, week int) (string, error) {
+	return c.fetch(weekSchedulePathFor(year, term, week))
+}
+
+// Logout ends the portal session and discards its cookies.
+func (c *HTTPClient) Logout() error {
+	if c.client.Jar == nil {
+		return nil
+	}
+	defer func() { c.client.Jar = nil }()
+
+	resp, err := c.client.Get(c.baseURL + logoutPath)
+	if err != nil {
+		return fmt.Errorf("error logging out: %v", err)
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// fetch retrieves a portal page within the current session.
+func (c *HTTPClient) fetch(path string) (string, error) {
+	if c.client.Jar == nil {
+		return "", fmt.Errorf("not logged in")
+	}
+
+	pageURL := c.baseURL + path
+	resp, err := c.client.Get(pageURL)
+	if err != nil {
+		return "", fmt.Errorf("could not fetch %s: %v", pageURL, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status fetching %s: %s", pageURL, resp.Status)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("could not read %s: %v", pageURL, err)
+	}
+
+	// An expired session redirects back to the login page
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(string(body)))
+	if err == nil && isLoginPage(doc) {
+		return "", fmt.Errorf("session expired while fetching %s", pageURL)
+	}
+	return string(body), nil
+}
+
+// readDocument parses the body of a successful response and closes it.
+func readDocument(resp *http.Response) (*goquery.Document, error) {
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s from %s", resp.Status, resp.Request.URL)
+	}
+	return goquery.NewDocumentFromReader(resp.Body)
+}
+
+// isLoginPage reports whether a page contains the portal's login form.
+func isLoginPage(doc *goquery.Document) bool {
+	return doc.Find("input[name='"+usernameField+"']").Length() > 0
+}
@@ -0,0 +1,78 @@
+package scraper
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"strconv"
+	"time"
+
+	ics "github.com/arran4/golang-ical"
+)
+
+const (
+	icsProductID = "-//FunTech Calendar//Lesson Sync//EN"
+	// icsKeyProperty holds a managed event's lesson key, like lessonKeyProperty in Google Calendar.
+	icsKeyProperty        = ics.ComponentProperty("X-FTCALENDAR-LESSON-KEY")
+	icsLessonTypeProperty = ics.ComponentProperty("X-FTCALENDAR-LESSON-TYPE")
+)
+
+// icsUID derives the iCalendar UID of a managed event from its lesson key, so an event keeps its
+// UID across syncs.
+func icsUID(key string) string {
+	hash := md5.Sum([]byte(key))
+	return hex.EncodeToString(hash[:]) + "@ftcalendar"
+}
+
+// newICSCalendar creates an empty calendar for synced lessons.
+func newICSCalendar() *ics.Calendar {
+	cal := ics.NewCalendar()
+	cal.SetProductId(icsProductID)
+	cal.SetMethod(ics.MethodPublish)
+	cal.SetXWRCalName("FunTech Lessons")
+	return cal
+}
+
+// toICSEvent builds the iCalendar event for a managed event, tagged with its lesson key.
+func toICSEvent(event CalendarEvent, uid string) *ics.VEvent {
+	vevent := ics.NewEvent(uid)
+	vevent.SetDtStampTime(time.Now())
+	vevent.SetSummary(event.Summary)
+	vevent.SetStartAt(event.Start)
+	vevent.SetEndAt(event.End)
+	vevent.SetProperty(icsKeyProperty, event.Key)
+	vevent.SetProperty(icsLessonTypeProperty, strconv.Itoa(event.LessonType))
+	return vevent
+}
+
+// fromICSEvent converts a timed iCalendar event. All-day events are never lessons and are skipped.
+func fromICSEvent(vevent *ics.VEvent) (CalendarEvent, bool) {
+	start, err := vevent.GetStartAt()
+	if err != nil {
+		return CalendarEvent{}, false
+	}
+	end, err := vevent.GetEndAt()
+	if err != nil {
+		return CalendarEvent{}, false
+	}
+
+	event := CalendarEvent{ID: vevent.Id(), Start: start, End: end}
+	if summary := vevent.GetProperty(ics.ComponentPropertySummary); summary != nil {
+		event.Summary = summary.Value
+	}
+	if key := vevent.GetProperty(icsKeyProperty); key != nil {
+		event.Key = key.Value
+		event.Managed = key.Value != ""
+	}
+	if lessonType := vevent.GetProperty(icsLessonTypeProperty); lessonType != nil {
+		event.LessonType, _ = strconv.Atoi(lessonType.Value)
+	}
+	return event, true
+}
+
+// inWindow reports whether an event overlaps timeMin and timeMax. A zero window contains every event.
+func inWindow(event CalendarEvent, timeMin, timeMax time.Time) bool {
+	if timeMin.IsZero() && timeMax.IsZero() {
+		return true
+	}
+	return event.End.After(timeMin) && event.Start.Before(timeMax)
+}
@@ -0,0 +1,79 @@
+package scraper
+
+import (
+	"fmt"
+	"time"
+
+	ics "github.com/arran4/golang-ical"
+)
+
+const feedTimezone = "Europe/London"
+
+// BuildLessonFeed renders the lessons as an iCalendar feed for calendar apps to subscribe to. Each
+// lesson keeps the same UID across scrapes, so rescheduled lessons move instead of duplicating.
+func BuildLessonFeed(lessons []Lesson) string {
+	loc, _ := time.LoadLocation(feedTimezone)
+
+	cal := newICSCalendar()
+	cal.SetXWRTimezone(feedTimezone)
+	cal.SetXPublishedTTL("PT1H") // Ask subscribers to refresh hourly
+	cal.SetRefreshInterval("PT1H")
+	cal.AddVTimezone(londonTimezone())
+
+	tzid := &ics.KeyValues{Key: string(ics.ParameterTzid), Value: []string{feedTimezone}}
+	for _, lesson := range lessons {
+		event, err := LessonToEvent(lesson)
+		if err != nil {
+			fmt.Printf("Skipping lesson %s in feed: %v\n", lesson.Key, err)
+			continue
+		}
+
+		vevent := cal.AddEvent(icsUID(lesson.Key))
+		vevent.SetDtStampTime(time.Now())
+		vevent.SetSummary(event.Summary)
+		vevent.SetProperty(ics.ComponentPropertyDtStart, event.Start.In(loc).Format("20060102T150405"), tzid)
+		vevent.SetProperty(ics.ComponentPropertyDtEnd, event.End.In(loc).Format("20060102T150405"), tzid)
+		vevent.AddCategory(lessonTypeCategory(lesson.LessonType))
+		vevent.SetProperty(icsKeyProperty, lesson.Key)
+	}
+
+	return cal.Serialize()
+}
+
+// lessonTypeCategory names the category of a lesson type after the colour the portal, and the
+// Google Calendar sync, shows it in.
+func lessonTypeCategory(lessonType int) string {
+	switch lessonType {
+	case 1:
+		return "Blue lesson"
+	case 2:
+		return "Yellow lesson"
+	case 3:
+		return "Red lesson"
+	default:
+		return "Green lesson"
+	}
+}
+
+// londonTimezone describes Europe/London with the current UK daylight saving rules, so clients
+// without a timezone database still place lessons correctly.
+func londonTimezone() *ics.VTimezone {
+	timezone := ics.NewTimezone(feedTimezone)
+
+	daylight := &ics.Daylight{}
+	daylight.AddProperty(ics.ComponentProperty("TZOFFSETFROM"), "+0000")
+	daylight.AddProperty(ics.ComponentProperty("TZOFFSETTO"), "+0100")
+	daylight.AddProperty(ics.ComponentProperty("TZNAME"), "BST")
+	daylight.AddProperty(ics.ComponentPropertyDtStart, "19810329T010000")
+	daylight.AddProperty(ics.ComponentPropertyRrule, "FREQ=YEARLY;BYMONTH=3;BYDAY=-1SU")
+
+	standard := &ics.Standard{}
+	standard.AddProperty(ics.ComponentProperty("TZOFFSETFROM"), "+0100")
+	standard.AddProperty(ics.ComponentProperty("TZOFFSETTO"), "+0000")
+	standard.AddProperty(ics.ComponentProperty("TZNAME"), "GMT")
+	standard.AddProperty(ics.ComponentPropertyDtStart, "19961027T020000")
+	standard.AddProperty(ics.ComponentPropertyRrule, "FREQ=YEARLY;BYMONTH=10;BYDAY=-1SU")
+
+	timezone.Components = append(timezone.Components, daylight, standard)
+	return timezone
+}
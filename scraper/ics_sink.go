@@ -0,0 +1,92 @@
+package scraper
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	ics "github.com/arran4/golang-ical"
+)
+
+// ICSFileSink syncs lessons into an iCalendar file, e.g. one served to calendar apps that subscribe
+// to a URL. Events in the file without a lesson key are kept as they are.
+type ICSFileSink struct {
+	Path string
+}
+
+// ListEvents reads the events in the file. A missing file has no events.
+func (s *ICSFileSink) ListEvents(timeMin, timeMax time.Time) ([]CalendarEvent, error) {
+	cal, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+
+	var events []CalendarEvent
+	for _, vevent := range cal.Events() {
+		event, ok := fromICSEvent(vevent)
+		if ok && inWindow(event, timeMin, timeMax) {
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
+
+// ApplyPlan rewrites the file with the changes in the plan.
+func (s *ICSFileSink) ApplyPlan(plan *SyncPlan) error {
+	if plan.Empty() {
+		return nil
+	}
+
+	cal, err := s.load()
+	if err != nil {
+		return err
+	}
+
+	for _, event := range plan.Deletes {
+		fmt.Printf("Deleting event '%s' (UID: %s)\n", event.Summary, event.ID)
+		cal.RemoveEvent(event.ID)
+	}
+	for _, update := range plan.Updates {
+		fmt.Printf("Updating event '%s' (Key: %s)\n", update.New.Summary, update.New.Key)
+		cal.RemoveEvent(update.Old.ID)
+		cal.AddVEvent(toICSEvent(update.New, update.Old.ID))
+	}
+	for _, event := range plan.Inserts {
+		fmt.Printf("Inserting new event '%s' (Key: %s)\n", event.Summary, event.Key)
+		cal.AddVEvent(toICSEvent(event, icsUID(event.Key)))
+	}
+
+	return s.save(cal)
+}
+
+// load parses the file, or returns an empty calendar if it does not exist yet.
+func (s *ICSFileSink) load() (*ics.Calendar, error) {
+	file, err := os.Open(s.Path)
+	if os.IsNotExist(err) {
+		return newICSCalendar(), nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error opening calendar file %s: %v", s.Path, err)
+	}
+	defer file.Close()
+
+	cal, err := ics.ParseCalendar(file)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing calendar file %s: %v", s.Path, err)
+	}
+	return cal, nil
+}
+
+// save atomically replaces the file so subscribers never read a half-written calendar.
+func (s *ICSFileSink) save(cal *ics.Calendar) error {
+	if err := os.MkdirAll(filepath.Dir(s.Path), 0755); err != nil {
+		return fmt.Errorf("failed to create directory for calendar file %s: %v", s.Path, err)
+	}
+
+	tmpFile := s.Path + ".tmp"
+	if err := os.WriteFile(tmpFile, []byte(cal.Serialize()), 0644); err != nil {
+		return fmt.Errorf("failed to write calendar file %s: %v", s.Path, err)
+	}
+	return os.Rename(tmpFile, s.Path)
+}
@@ -0,0 +1,79 @@
+package scraper
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	ics "github.com/arran4/golang-ical"
+)
+
+// icsSummaries parses the calendar file and returns the summary of each event in it.
+func icsSummaries(t *testing.T, path string) []string {
+	t.Helper()
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	cal, err := ics.ParseCalendar(file)
+	if err != nil {
+		t.Fatalf("calendar file does not parse: %v", err)
+	}
+
+	var summaries []string
+	for _, vevent := range cal.Events() {
+		summaries = append(summaries, vevent.GetProperty(ics.ComponentPropertySummary).Value)
+	}
+	return summaries
+}
+
+func TestICSFileSinkRewritesFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "feeds", "lessons.ics")
+	sink := &ICSFileSink{Path: path}
+
+	// The user's own event is already in the file and must survive every rewrite
+	own := newICSCalendar()
+	vevent := own.AddEvent("dentist@example.com")
+	vevent.SetSummary("Dentist")
+	vevent.SetStartAt(time.Date(2024, time.September, 24, 9, 0, 0, 0, time.UTC))
+	vevent.SetEndAt(time.Date(2024, time.September, 24, 10, 0, 0, 0, time.UTC))
+	if err := sink.save(own); err != nil {
+		t.Fatal(err)
+	}
+
+	monday := testLesson("Python L2", 0, "16:00", "17:00")
+	thursday := testLesson("Scratch L1", 3, "16:00", "17:00")
+	if _, err := SyncLessons(sink, testWeek(monday, thursday), SyncOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := strings.Join(icsSummaries(t, path), ", "), "Dentist, Python L2, Scratch L1"; got != want {
+		t.Errorf("after first sync, file has %s; want %s", got, want)
+	}
+
+	// Thursday's lesson was cancelled
+	plan, err := SyncLessons(sink, testWeek(monday), SyncOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.Deletes) != 1 || plan.Deletes[0].Key != thursday.Key {
+		t.Errorf("plan deletes %v, want only %s", plan.Deletes, thursday.Key)
+	}
+	if got, want := strings.Join(icsSummaries(t, path), ", "), "Dentist, Python L2"; got != want {
+		t.Errorf("after lesson removed, file has %s; want %s", got, want)
+	}
+
+	// A sync with nothing to change leaves the file alone
+	plan, err = SyncLessons(sink, testWeek(monday), SyncOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !plan.Empty() {
+		t.Errorf("resync plan is not empty:\n%s", plan)
+	}
+	if _, err := os.Stat(path + ".tmp"); !os.IsNotExist(err) {
+		t.Errorf("temporary file left behind: %v", err)
+	}
+}
@@ -0,0 +1,104 @@
+package scraper
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// LessonChangeKind is how a lesson changed between two scrapes.
+type LessonChangeKind string
+
+const (
+	LessonAdded       LessonChangeKind = "added"       // The lesson appeared on the timetable
+	LessonCancelled   LessonChangeKind = "cancelled"   // The lesson disappeared from the timetable
+	LessonRescheduled LessonChangeKind = "rescheduled" // The lesson's date, times or type changed
+)
+
+// LessonChange is a change to one of a tutor's lessons found by comparing a scrape with the previous one.
+// Old is unset for added lessons and New for cancelled ones.
+type LessonChange struct {
+	Kind       LessonChangeKind
+	Key        string
+	DetectedAt time.Time
+	Old        Lesson
+	New        Lesson
+}
+
+// CompareLessons returns a rescheduled change if the times or type of a lesson with the same key
+// differ between the two scrapes, or nil if they are the same. A lesson moved to another day has a
+// new key; see MatchReschedules.
+func CompareLessons(old, new Lesson) *LessonChange {
+	if old.Date.Equal(new.Date) && old.StartTime == new.StartTime &&
+		old.EndTime == new.EndTime && old.LessonType == new.LessonType {
+		return nil
+	}
+	return &LessonChange{Kind: LessonRescheduled, Key: new.Key, Old: old, New: new}
+}
+
+// MatchReschedules turns a lesson cancelled and a lesson of the same course and group added in the
+// same week into a single rescheduled change, as that is a lesson moved to another day. Lessons are
+// paired in the order they are listed; the other changes are returned as they are.
+func MatchReschedules(changes []LessonChange) []LessonChange {
+	cancelled := make(map[string][]int) // Indexes of cancelled lessons by week and course
+	for i, change := range changes {
+		if change.Kind == LessonCancelled {
+			id := change.Old.WeekKey + "/" + change.Old.Course
+			cancelled[id] = append(cancelled[id], i)
+		}
+	}
+
+	moved := make(map[int]bool) // Indexes of cancelled lessons that were moved
+	var matched []LessonChange
+	for _, change := range changes {
+		switch change.Kind {
+		case LessonCancelled:
+			continue
+		case LessonAdded:
+			id := change.New.WeekKey + "/" + change.New.Course
+			if candidates := cancelled[id]; len(candidates) > 0 {
+				old := changes[candidates[0]].Old
+				cancelled[id] = candidates[1:]
+				moved[candidates[0]] = true
+				change = LessonChange{Kind: LessonRescheduled, Key: change.Key, DetectedAt: change.DetectedAt, Old: old, New: change.New}
+			}
+		}
+		matched = append(matched, change)
+	}
+	for i, change := range changes {
+		if change.Kind == LessonCancelled && !moved[i] {
+			matched = append(matched, change)
+		}
+	}
+	return matched
+}
+
+// String describes the change for the tutor, e.g. "Thursday 17/10 16:00 Python L2 moved to 17:00".
+func (c LessonChange) String() string {
+	switch c.Kind {
+	case LessonAdded:
+		return fmt.Sprintf("New lesson: %s %s-%s %s", lessonDay(c.New), c.New.StartTime, c.New.EndTime, c.New.Course)
+	case LessonCancelled:
+		return fmt.Sprintf("Cancelled: %s %s %s", lessonDay(c.Old), c.Old.StartTime, c.Old.Course)
+	}
+
+	was := fmt.Sprintf("%s %s %s", lessonDay(c.Old), c.Old.StartTime, c.Old.Course)
+	var changes []string
+	if !c.Old.Date.Equal(c.New.Date) {
+		changes = append(changes, fmt.Sprintf("moved to %s %s", lessonDay(c.New), c.New.StartTime))
+	} else if c.Old.StartTime != c.New.StartTime {
+		changes = append(changes, "moved to "+c.New.StartTime)
+	}
+	if c.Old.EndTime != c.New.EndTime {
+		changes = append(changes, "now ends at "+c.New.EndTime)
+	}
+	if c.Old.LessonType != c.New.LessonType {
+		changes = append(changes, "is now a "+lessonTypeCategory(c.New.LessonType))
+	}
+	return was + " " + strings.Join(changes, " and ")
+}
+
+// lessonDay names the day of a lesson with its date, e.g. "Thursday 17/10".
+func lessonDay(lesson Lesson) string {
+	return fmt.Sprintf("%s %s", lesson.Day, lesson.Date.Format("02/01"))
+}
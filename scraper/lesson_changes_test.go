@@ -0,0 +1,131 @@
+package scraper
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// testLesson builds a lesson of the week starting 23/09/2024; day is 0 for Monday.
+func testLesson(course string, day int, start, end string) Lesson {
+	week := Week{Year: "2024-25", Term: 1, WeekNumber: 1, StartDate: "23/09/2024"}
+	date := time.Date(2024, time.September, 23+day, 0, 0, 0, 0, time.UTC)
+	return Lesson{
+		Key:        LessonKey(week, date.Weekday().String(), course, 0),
+		WeekKey:    week.Key(),
+		Course:     course,
+		Day:        date.Weekday().String(),
+		StartTime:  start,
+		EndTime:    end,
+		Date:       date,
+		LessonType: 1,
+	}
+}
+
+func TestLessonChangeString(t *testing.T) {
+	thursday := testLesson("Python L2", 3, "16:00", "17:00")
+	later := testLesson("Python L2", 3, "17:00", "18:00")
+	friday := testLesson("Python L2", 4, "16:00", "17:00")
+	trial := thursday
+	trial.LessonType = 2
+
+	tests := []struct {
+		name   string
+		change LessonChange
+		want   string
+	}{
+		{
+			name:   "added",
+			change: LessonChange{Kind: LessonAdded, New: thursday},
+			want:   "New lesson: Thursday 26/09 16:00-17:00 Python L2",
+		},
+		{
+			name:   "cancelled",
+			change: LessonChange{Kind: LessonCancelled, Old: thursday},
+			want:   "Cancelled: Thursday 26/09 16:00 Python L2",
+		},
+		{
+			name:   "moved to a later time",
+			change: *CompareLessons(thursday, later),
+			want:   "Thursday 26/09 16:00 Python L2 moved to 17:00 and now ends at 18:00",
+		},
+		{
+			name:   "moved to another day",
+			change: LessonChange{Kind: LessonRescheduled, Old: thursday, New: friday},
+			want:   "Thursday 26/09 16:00 Python L2 moved to Friday 27/09 16:00",
+		},
+		{
+			name:   "type changed",
+			change: *CompareLessons(thursday, trial),
+			want:   "Thursday 26/09 16:00 Python L2 is now a Yellow lesson",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.change.String(); got != tt.want {
+				t.Errorf("String() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompareLessonsUnchanged(t *testing.T) {
+	lesson := testLesson("Python L2", 3, "16:00", "17:00")
+	if change := CompareLessons(lesson, lesson); change != nil {
+		t.Errorf("CompareLessons of the same lesson = %v, want nil", change)
+	}
+}
+
+func TestMatchReschedules(t *testing.T) {
+	thursday := testLesson("Python L2", 3, "16:00", "17:00")
+	friday := testLesson("Python L2", 4, "16:00", "17:00")
+	scratch := testLesson("Scratch L1", 5, "10:00", "11:00")
+	otherWeek := friday
+	otherWeek.WeekKey = "2024-25/1/2/2024-09-30"
+
+	tests := []struct {
+		name    string
+		changes []LessonChange
+		want    []LessonChange
+	}{
+		{
+			name: "moved to another day",
+			changes: []LessonChange{
+				{Kind: LessonAdded, Key: friday.Key, New: friday},
+				{Kind: LessonCancelled, Key: thursday.Key, Old: thursday},
+			},
+			want: []LessonChange{{Kind: LessonRescheduled, Key: friday.Key, Old: thursday, New: friday}},
+		},
+		{
+			name: "different course",
+			changes: []LessonChange{
+				{Kind: LessonAdded, Key: scratch.Key, New: scratch},
+				{Kind: LessonCancelled, Key: thursday.Key, Old: thursday},
+			},
+			want: []LessonChange{
+				{Kind: LessonAdded, Key: scratch.Key, New: scratch},
+				{Kind: LessonCancelled, Key: thursday.Key, Old: thursday},
+			},
+		},
+		{
+			name: "different week",
+			changes: []LessonChange{
+				{Kind: LessonAdded, Key: otherWeek.Key, New: otherWeek},
+				{Kind: LessonCancelled, Key: thursday.Key, Old: thursday},
+			},
+			want: []LessonChange{
+				{Kind: LessonAdded, Key: otherWeek.Key, New: otherWeek},
+				{Kind: LessonCancelled, Key: thursday.Key, Old: thursday},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := MatchReschedules(tt.changes); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("MatchReschedules = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -3,114 +3,107 @@ package scraper
 import (
 	"fmt"
 	"strings"
-
-	"github.com/PuerkitoBio/goquery"
-	"github.com/playwright-community/playwright-go"
+	"time"
 )
 
-// ScrapeLessonsWithClient scrapes lessons for all weeks in the term or year using Playwright.
-func ScrapeLessonsWithClient(browser playwright.Browser, username, password string, weeks []Week, year string) []Lesson {
-	baseURL := "https://funtech.co.uk/tutor/tutors/tt_week_schedule"
-
-	// Perform login using the Playwright login function
-	page, err := login(browser, username, password)
-	if err != nil {
+// ScrapeLessonsWithClient scrapes lessons for all weeks in the term or year through the portal client.
+// It returns one result per week; an error is only returned if login fails.
+func ScrapeLessonsWithClient(client PortalClient, username, password string, weeks []Week, year string) ([]ScrapeResult, error) {
+	// Perform login using the portal client
+	if err := client.Login(username, password); err != nil {
 		fmt.Println("Login failed. Check your credentials and try again.")
-		fmt.Println("Credentials: ", username, password)
-		return nil
+		return nil, fmt.Errorf("login failed for user %s: %v", username, err)
 	}
 
-	var allLessons []Lesson
+	var results []ScrapeResult
 	for _, week := range weeks {
-		dataURL := fmt.Sprintf("%s/year:%s/term:%d/week:%d", baseURL, year, week.Term, week.WeekNumber)
-		fmt.Printf("Accessing URL: %s\n", dataURL)
-		lessonsForWeek := scrapeLessonsPlaywright(page, dataURL, week)
-		fmt.Printf("Lessons retrieved from URL %s: %d\n", dataURL, len(lessonsForWeek))
-		allLessons = append(allLessons, lessonsForWeek...)
+		dataPath := weekSchedulePathFor(year, week.Term, week.WeekNumber)
+		fmt.Printf("Accessing URL: %s\n", dataPath)
+		result := scrapeLessons(client, year, week)
+		if result.Status == ScrapeFailed {
+			fmt.Printf("Error scraping lessons from URL %s: %v\n", dataPath, result.Err)
+		} else {
+			fmt.Printf("Lessons retrieved from URL %s: %d\n", dataPath, len(result.Lessons))
+		}
+		results = append(results, result)
 	}
 
 	// Log total number of lessons retrieved across all weeks
-	fmt.Printf("Total lessons retrieved across all weeks: %d\n", len(allLessons))
+	fmt.Printf("Total lessons retrieved across all weeks: %d\n", len(LessonsFromResults(results)))
 
 	// Log out after scraping is complete
-	logoutURL := "https://funtech.co.uk/tutor/tutors/logout"
-	if _, err := page.Goto(logoutURL, playwright.PageGotoOptions{
-		WaitUntil: playwright.WaitUntilStateLoad,
-	}); err != nil {
+	if err := client.Logout(); err != nil {
 		fmt.Printf("Error logging out: %v\n", err)
 	}
 
-	return allLessons
+	return results, nil
+}
+
+// ScrapeAllLessonsWithClient scrapes the availability and then the lessons for every term of a user.
+func ScrapeAllLessonsWithClient(client PortalClient, username, password string) ([]ScrapeResult, error) {
+	_, weeksByTerm, year := ScrapeAvailabilityWithClient(client, username, password)
+	if weeksByTerm == nil || year == "" {
+		return nil, fmt.Errorf("availability scraping failed for user %s", username)
+	}
+
+	var allResults []ScrapeResult
+	for _, weeks := range weeksByTerm {
+		results, err := ScrapeLessonsWithClient(client, username, password, weeks, year)
+		if err != nil {
+			return nil, err
+		}
+		allResults = append(allResults, results...)
+	}
+	return allResults, nil
 }
 
-// scrapeLessonsPlaywright scrapes lessons from the provided URL using Playwright.
-func scrapeLessonsPlaywright(page playwright.Page, dataURL string, week Week) []Lesson {
-	// Navigate to the lesson page
-	if _, err := page.Goto(dataURL, playwright.PageGotoOptions{
-		WaitUntil: playwright.WaitUntilStateLoad, // Wait until the "load" event
-	}); err != nil {
-		fmt.Printf("Error navigating to lessons page: %v\n", err)
-		return nil
+// scrapeLessons scrapes lessons from the timetable of the given week.
+func scrapeLessons(client PortalClient, year string, week Week) ScrapeResult {
+	dataURL := weekSchedulePathFor(year, week.Term, week.WeekNumber)
+	if week.Year == "" {
+		week.Year = year
 	}
+	result := ScrapeResult{Week: week, FetchedAt: time.Now()}
 
-	// Get the page content dynamically rendered via JavaScript
-	pageHTML, err := page.Content()
+	// Fetch the lesson page
+	pageHTML, err := client.FetchWeekSchedule(year, week.Term, week.WeekNumber)
 	if err != nil {
-		fmt.Printf("Error retrieving content for URL %s: %v\n", dataURL, err)
-		return nil
+		result.Status = ScrapeFailed
+		result.Err = fmt.Errorf("error retrieving content: %v", err)
+		return result
 	}
 
 	// Parse the page HTML
-	doc, err := goquery.NewDocumentFromReader(strings.NewReader(pageHTML))
+	lessons, warnings, err := ParseWeekSchedule(strings.NewReader(pageHTML), week)
 	if err != nil {
-		fmt.Printf("Error parsing HTML for URL %s: %v\n", dataURL, err)
-		return nil
+		result.Status = ScrapeFailed
+		result.Err = err
+		return result
 	}
+	result.Lessons = lessons
+	result.Warnings = warnings
 
-	var lessons []Lesson
-	doc.Find("h4.panel-title").Each(func(i int, s *goquery.Selection) {
-		lessonInfo := s.Find("span").Text()
-		lessonInfo = strings.TrimSpace(lessonInfo)
-
-		// Log the raw lesson info being processed
-		fmt.Printf("Processing raw lesson info: %s\n", lessonInfo)
-
-		lessonParts := strings.Split(lessonInfo, " • ")
-		if len(lessonParts) < 4 {
-			// Log if a lesson is skipped due to incomplete data
-			fmt.Printf("Skipping lesson due to incomplete data: %v\n", lessonParts)
-			return
-		}
-
-		// Proceed to extract lesson details
-		course := lessonParts[0] + " " + lessonParts[1]
-		day := convertToFullWeekday(strings.TrimSpace(lessonParts[2]))
-		timeRange := strings.TrimSpace(lessonParts[3])
-		startTime, endTime := parseTimeRange(timeRange)
-
-		lessonType := getLessonType(s)
-
-		// Calculate lesson date based on the week start date
-		lessonDate := calculateLessonDate(week, day)
-
-		lesson := Lesson{
-			Course:     course,
-			Day:        day,
-			StartTime:  startTime,
-			EndTime:    endTime,
-			Date:       lessonDate,
-			LessonType: lessonType,
-		}
-
-		// Log each lesson's complete data
+	// Log skipped rows and each lesson's complete data
+	for _, warning := range warnings {
+		fmt.Printf("Skipping lesson on URL %s: %s\n", dataURL, warning)
+	}
+	for _, lesson := range lessons {
 		fmt.Printf("Retrieved Lesson - Course: %s, Day: %s, Start: %s, End: %s, Date: %v, Lesson Type: %d\n",
 			lesson.Course, lesson.Day, lesson.StartTime, lesson.EndTime, lesson.Date, lesson.LessonType)
-
-		lessons = append(lessons, lesson)
-	})
+	}
 
 	// Log the total number of lessons retrieved from the URL
 	fmt.Printf("Total lessons retrieved from URL %s: %d\n", dataURL, len(lessons))
 
-	return lessons
+	switch {
+	case len(lessons) > 0:
+		result.Status = ScrapeOK
+	case len(warnings) > 0:
+		// Every row was malformed, so the markup has most likely changed
+		result.Status = ScrapeFailed
+		result.Err = fmt.Errorf("no lessons parsed, %d rows skipped", len(warnings))
+	default:
+		result.Status = ScrapeEmpty
+	}
+	return result
 }
@@ -6,17 +6,34 @@ import (
 	"github.com/playwright-community/playwright-go"
 )
 
-// login uses Playwright to handle the login process and returns the page after a successful login.
-func login(browser playwright.Browser, username, password string) (playwright.Page, error) {
-	loginURL := "https://funtech.co.uk/tutors"
+// PlaywrightClient is a PortalClient that drives a headless browser through the portal.
+type PlaywrightClient struct {
+	browser playwright.Browser
+	baseURL string
+	page    playwright.Page
+}
+
+// NewPlaywrightClient creates a PortalClient backed by the given Playwright browser.
+// An empty baseURL targets the live FunTech portal.
+func NewPlaywrightClient(browser playwright.Browser, baseURL string) *PlaywrightClient {
+	return &PlaywrightClient{browser: browser, baseURL: portalURL(baseURL)}
+}
+
+// Login uses Playwright to handle the login process and keeps the page for further actions.
+func (c *PlaywrightClient) Login(username, password string) error {
+	loginURL := c.baseURL + loginPath
 
-	// Step 1: Create a new page
+	// Step 1: Create a new page, closing any page left over from a previous session
 	fmt.Println("Attempting to login with Playwright...")
+	if c.page != nil {
+		c.page.Close()
+		c.page = nil
+	}
 
-	page, err := browser.NewPage()
+	page, err := c.browser.NewPage()
 	if err != nil {
 		fmt.Printf("Could not create a new page: %v\n", err)
-		return nil, err
+		return err
 	}
 
 	// Step 2: Navigate to the login page and wait for it to fully load
@@ -24,23 +41,87 @@ func login(browser playwright.Browser, username, password string) (playwright.Pa
 		WaitUntil: playwright.WaitUntilStateLoad, // Wait until the "load" event
 	}); err != nil {
 		fmt.Printf("Could not navigate to login page: %v\n", err)
-		return nil, err
+		page.Close()
+		return err
 	}
 
 	// Step 3: Fill the login form and submit it
-	if err := page.Fill("input[name='data[Tutor][username]']", username); err != nil {
+	if err := page.Fill("input[name='"+usernameField+"']", username); err != nil {
 		fmt.Printf("Could not fill username: %v\n", err)
-		return nil, err
+		page.Close()
+		return err
 	}
-	if err := page.Fill("input[name='data[Tutor][password]']", password); err != nil {
+	if err := page.Fill("input[name='"+passwordField+"']", password); err != nil {
 		fmt.Printf("Could not fill password: %v\n", err)
-		return nil, err
+		page.Close()
+		return err
 	}
 	if err := page.Click("button[type='submit']"); err != nil {
 		fmt.Printf("Could not submit login form: %v\n", err)
-		return nil, err
+		page.Close()
+		return err
+	}
+
+	// Keep the page so it can be used for further actions after login
+	c.page = page
+	return nil
+}
+
+// FetchAvailability returns the availability overview page once it has fully loaded.
+func (c *PlaywrightClient) FetchAvailability() (string, error) {
+	return c.fetch(availabilityPath, playwright.WaitUntilStateLoad)
+}
+
+// FetchTerm returns a term's availability page after the JavaScript has loaded.
+func (c *PlaywrightClient) FetchTerm(termPath string) (string, error) {
+	return c.fetch(termPath, playwright.WaitUntilStateNetworkidle)
+}
+
+// FetchWeekAvailability returns a week's availability page after the JavaScript has loaded.
+func (c *PlaywrightClient) FetchWeekAvailability(weekPath string) (string, error) {
+	return c.fetch(weekPath, playwright.WaitUntilStateNetworkidle)
+}
+
+// FetchWeekSchedule returns the timetable page for a week once it has fully loaded.
+func (c *PlaywrightClient) FetchWeekSchedule(year string, term, week int) (string, error) {
+	return c.fetch(weekSchedulePathFor(year, term, week), playwright.WaitUntilStateLoad)
+}
+
+// Logout navigates to the logout page and closes the session's page.
+func (c *PlaywrightClient) Logout() error {
+	if c.page == nil {
+		return nil
+	}
+	defer func() {
+		c.page.Close()
+		c.page = nil
+	}()
+
+	if _, err := c.page.Goto(c.baseURL+logoutPath, playwright.PageGotoOptions{
+		WaitUntil: playwright.WaitUntilStateLoad,
+	}); err != nil {
+		return fmt.Errorf("error logging out: %v", err)
+	}
+	return nil
+}
+
+// fetch navigates the logged-in page to a portal path and returns the rendered HTML.
+func (c *PlaywrightClient) fetch(path string, waitUntil *playwright.WaitUntilState) (string, error) {
+	if c.page == nil {
+		return "", fmt.Errorf("not logged in")
 	}
 
-	// Return the page so it can be used for further actions after login
-	return page, nil
+	pageURL := c.baseURL + path
+	if _, err := c.page.Goto(pageURL, playwright.PageGotoOptions{
+		WaitUntil: waitUntil,
+	}); err != nil {
+		return "", fmt.Errorf("could not navigate to %s: %v", pageURL, err)
+	}
+
+	// Get the page content dynamically rendered via JavaScript
+	content, err := c.page.Content()
+	if err != nil {
+		return "", fmt.Errorf("could not get content for %s: %v", pageURL, err)
+	}
+	return content, nil
 }
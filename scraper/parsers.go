@@ -0,0 +1,226 @@
+package scraper
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// AcademicYear is the academic year shown on the portal, e.g. "2024-25".
+type AcademicYear string
+
+// WeekLink is a link to a week's availability page found on a term page.
+type WeekLink struct {
+	WeekNumber int
+	URL        string
+}
+
+// ParseWarning describes a row of a portal page that was skipped because it could not be parsed.
+type ParseWarning struct {
+	Row    int    // Zero-based position of the row on the page
+	Text   string // Raw text of the row
+	Reason string
+}
+
+func (w ParseWarning) String() string {
+	return fmt.Sprintf("row %d: %s (%q)", w.Row, w.Reason, w.Text)
+}
+
+// ParseWeekSchedule parses the lessons from a week's timetable page.
+// Malformed lesson rows are skipped and reported as warnings.
+func ParseWeekSchedule(r io.Reader, week Week) ([]Lesson, []ParseWarning, error) {
+	doc, err := goquery.NewDocumentFromReader(r)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error parsing week schedule HTML: %v", err)
+	}
+
+	var lessons []Lesson
+	var warnings []ParseWarning
+	slots := map[string]int{}
+	doc.Find("h4.panel-title").Each(func(i int, s *goquery.Selection) {
+		lessonInfo := strings.TrimSpace(s.Find("span").Text())
+		warn := func(reason string) {
+			warnings = append(warnings, ParseWarning{Row: i, Text: lessonInfo, Reason: reason})
+		}
+
+		lessonParts := strings.Split(lessonInfo, " • ")
+		if len(lessonParts) < 4 {
+			warn(fmt.Sprintf("expected at least 4 parts separated by \" • \", got %d", len(lessonParts)))
+			return
+		}
+
+		// Extract lesson details
+		course := lessonParts[0] + " " + lessonParts[1]
+		day := convertToFullWeekday(strings.TrimSpace(lessonParts[2]))
+		if day == "" {
+			warn(fmt.Sprintf("unknown day %q", strings.TrimSpace(lessonParts[2])))
+			return
+		}
+		startTime, endTime, err := parseTimeRange(strings.TrimSpace(lessonParts[3]))
+		if err != nil {
+			warn(err.Error())
+			return
+		}
+
+		// Calculate lesson date based on the week start date
+		lessonDate, err := calculateLessonDate(week, day)
+		if err != nil {
+			warn(err.Error())
+			return
+		}
+
+		// Number repeated lessons of the same course on the same day
+		slot := slots[day+"/"+course]
+		slots[day+"/"+course]++
+
+		lessons = append(lessons, Lesson{
+			Key:        LessonKey(week, day, course, slot),
+			WeekKey:    week.Key(),
+			Course:     course,
+			Day:        day,
+			StartTime:  startTime,
+			EndTime:    endTime,
+			Date:       lessonDate,
+			LessonType: getLessonType(s),
+		})
+	})
+
+	return lessons, warnings, nil
+}
+
+// ParseAvailabilityPage parses the academic year and the term tabs from the availability overview page.
+func ParseAvailabilityPage(r io.Reader) (AcademicYear, []Term, error) {
+	doc, err := goquery.NewDocumentFromReader(r)
+	if err != nil {
+		return "", nil, fmt.Errorf("error parsing availability HTML: %v", err)
+	}
+
+	year := extractYear(doc)
+	if year == "" {
+		return "", nil, fmt.Errorf("academic year not found on availability page")
+	}
+
+	terms := extractTerms(doc)
+	if len(terms) == 0 {
+		return year, nil, fmt.Errorf("no terms found on availability page")
+	}
+
+	return year, terms, nil
+}
+
+// ParseTermPage parses the weeks listed on a holiday term's availability page.
+// Menu links that are not a week's availability link are reported as warnings.
+func ParseTermPage(r io.Reader) ([]Week, []ParseWarning, error) {
+	doc, err := goquery.NewDocumentFromReader(r)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error parsing term HTML: %v", err)
+	}
+
+	var weeks []Week
+	var warnings []ParseWarning
+	doc.Find("table tbody tr").Each(func(rowIndex int, row *goquery.Selection) {
+		// Get the week start date from the header
+		row.Find("th").Each(func(colIndex int, col *goquery.Selection) {
+			startDate := strings.TrimSpace(col.Text())
+
+			// Process each "View" link for this week's availability
+			row.Find(".dropdown-menu li a").Each(func(linkIndex int, link *goquery.Selection) {
+				viewLink, exists := link.Attr("href")
+				if exists && strings.Contains(viewLink, availabilityPath+"/availability/") {
+					weeks = append(weeks, Week{
+						WeekNumber: linkIndex + 1,
+						StartDate:  startDate,
+						URL:        viewLink,
+					})
+				} else {
+					warnings = append(warnings, ParseWarning{
+						Row:    rowIndex,
+						Text:   strings.TrimSpace(link.Text()),
+						Reason: fmt.Sprintf("no 'View' link for week %d", linkIndex+1),
+					})
+				}
+			})
+		})
+	})
+
+	return weeks, warnings, nil
+}
+
+// ParseTermTimePage parses the links to each week's availability page from the "Term Time" page.
+// Cells without a "View" link are reported as warnings.
+func ParseTermTimePage(r io.Reader) ([]WeekLink, []ParseWarning, error) {
+	doc, err := goquery.NewDocumentFromReader(r)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error parsing term page HTML: %v", err)
+	}
+
+	var links []WeekLink
+	var warnings []ParseWarning
+	doc.Find("table tbody tr").Each(func(rowIndex int, row *goquery.Selection) {
+		row.Find("td.text-center").Each(func(colIndex int, col *goquery.Selection) {
+			viewLink := col.Find(".dropdown-menu li a").FilterFunction(func(_ int, s *goquery.Selection) bool {
+				return strings.Contains(s.Text(), "View")
+			}).AttrOr("href", "")
+
+			if viewLink == "" {
+				warnings = append(warnings, ParseWarning{
+					Row:    rowIndex,
+					Text:   strings.TrimSpace(col.Text()),
+					Reason: fmt.Sprintf("no 'View' link in column %d", colIndex+1),
+				})
+				return
+			}
+			links = append(links, WeekLink{WeekNumber: colIndex + 1, URL: viewLink})
+		})
+	})
+
+	return links, warnings, nil
+}
+
+// ParseWeekDates parses the start date (dd/mm/yyyy) from a week's availability page.
+func ParseWeekDates(r io.Reader) (string, error) {
+	doc, err := goquery.NewDocumentFromReader(r)
+	if err != nil {
+		return "", fmt.Errorf("error parsing week page HTML: %v", err)
+	}
+
+	// Find the paragraph element that contains the week dates
+	dateText := doc.Find(".page-header p").Text()
+
+	// Example expected format: "Year 2024-25 | Term 1 | Week 1 | 23/09/2024 - 29/09/2024"
+	parts := strings.Split(dateText, "|")
+	if len(parts) < 4 {
+		return "", fmt.Errorf("date string in unexpected format: %q", dateText)
+	}
+
+	// Extract the date range and split to get the start date
+	dateRange := strings.TrimSpace(parts[3])
+	dates := strings.Split(dateRange, "-")
+	if len(dates) < 2 {
+		return "", fmt.Errorf("unable to extract dates from date range: %q", dateRange)
+	}
+
+	// The start date is the first part
+	return strings.TrimSpace(dates[0]), nil
+}
+
+// extractYear extracts the academic year from the availability page.
+func extractYear(doc *goquery.Document) AcademicYear {
+	year := doc.Find("h1.no-margin-top small").Text()
+	year = strings.TrimSpace(year)
+	year = strings.Replace(year, "Year ", "", 1)
+	return AcademicYear(year)
+}
+
+// extractTerms extracts all available terms from the availability page, skipping tabs without a link.
+func extractTerms(doc *goquery.Document) []Term {
+	var terms []Term
+	doc.Find("ul.nav-tabs li a").Each(func(i int, s *goquery.Selection) {
+		if termURL, exists := s.Attr("href"); exists {
+			terms = append(terms, Term{Name: strings.TrimSpace(s.Text()), URL: termURL})
+		}
+	})
+	return terms
+}
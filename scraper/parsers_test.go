@@ -0,0 +1,148 @@
+package scraper
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func openTestdata(t *testing.T, name string) *os.File {
+	t.Helper()
+	f, err := os.Open(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { f.Close() })
+	return f
+}
+
+func TestParseWeekSchedule(t *testing.T) {
+	week := Week{Year: "2024-25", Term: 1, WeekNumber: 1, StartDate: "23/09/2024"}
+	date := func(day int) time.Time { return time.Date(2024, time.September, day, 0, 0, 0, 0, time.UTC) }
+
+	tests := []struct {
+		name         string
+		page         string
+		wantLessons  []Lesson
+		wantWarnings []string // Text of each warned row
+	}{
+		{
+			name: "well-formed and malformed rows",
+			page: "week_schedule.html",
+			wantLessons: []Lesson{
+				{
+					Key:        LessonKey(week, "Thursday", "Python L2", 0),
+					WeekKey:    week.Key(),
+					Course:     "Python L2",
+					Day:        "Thursday",
+					StartTime:  "16:00",
+					EndTime:    "17:00",
+					Date:       date(26),
+					LessonType: 1,
+				},
+				{
+					Key:        LessonKey(week, "Saturday", "Scratch L1", 0),
+					WeekKey:    week.Key(),
+					Course:     "Scratch L1",
+					Day:        "Saturday",
+					StartTime:  "10:00",
+					EndTime:    "11:00",
+					Date:       date(28),
+					LessonType: 0,
+				},
+				{
+					Key:        LessonKey(week, "Saturday", "Scratch L1", 1),
+					WeekKey:    week.Key(),
+					Course:     "Scratch L1",
+					Day:        "Saturday",
+					StartTime:  "11:30",
+					EndTime:    "12:30",
+					Date:       date(28),
+					LessonType: 3,
+				},
+			},
+			wantWarnings: []string{"Python • L3 • Fri"},
+		},
+		{
+			name: "empty timetable",
+			page: "week_schedule_empty.html",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lessons, warnings, err := ParseWeekSchedule(openTestdata(t, tt.page), week)
+			if err != nil {
+				t.Fatalf("ParseWeekSchedule: %v", err)
+			}
+			if !reflect.DeepEqual(lessons, tt.wantLessons) {
+				t.Errorf("lessons = %+v, want %+v", lessons, tt.wantLessons)
+			}
+
+			var warned []string
+			for _, warning := range warnings {
+				warned = append(warned, warning.Text)
+				if !strings.Contains(warning.Reason, "expected at least 4 parts") {
+					t.Errorf("warning reason = %q, want a part count", warning.Reason)
+				}
+			}
+			if !reflect.DeepEqual(warned, tt.wantWarnings) {
+				t.Errorf("warnings = %q, want %q", warned, tt.wantWarnings)
+			}
+		})
+	}
+}
+
+func TestParseAvailabilityPage(t *testing.T) {
+	tests := []struct {
+		name      string
+		page      string
+		wantYear  AcademicYear
+		wantTerms []Term
+		wantErr   bool
+	}{
+		{
+			name:     "terms with links",
+			page:     "availability.html",
+			wantYear: "2024-25",
+			wantTerms: []Term{
+				{Name: "Term Time", URL: "/tutor/tutor_available_times/index/1"},
+				{Name: "October Half Term", URL: "/tutor/tutor_available_times/index/2"},
+			},
+		},
+		{
+			name:    "missing academic year",
+			page:    "availability_no_year.html",
+			wantErr: true,
+		},
+		{
+			name:    "empty timetable",
+			page:    "week_schedule_empty.html",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			year, terms, err := ParseAvailabilityPage(openTestdata(t, tt.page))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("ParseAvailabilityPage succeeded, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseAvailabilityPage: %v", err)
+			}
+			if year != tt.wantYear {
+				t.Errorf("year = %q, want %q", year, tt.wantYear)
+			}
+			if !reflect.DeepEqual(terms, tt.wantTerms) {
+				t.Errorf("terms = %+v, want %+v", terms, tt.wantTerms)
+			}
+		})
+	}
+}
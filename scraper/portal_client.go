@@ -0,0 +1,85 @@
+package scraper
+
+import (
+	"fmt"
+	"strings"
+
+	"funtech-scraper/config"
+
+	"github.com/playwright-community/playwright-go"
+)
+
+const (
+	defaultPortalURL = "https://funtech.co.uk"
+	loginPath        = "/tutors"
+	logoutPath       = "/tutor/tutors/logout"
+	availabilityPath = "/tutor/tutor_available_times"
+	weekSchedulePath = "/tutor/tutors/tt_week_schedule"
+)
+
+// PortalClient is a logged-in session with the FunTech tutor portal. Paths passed to
+// the Fetch methods are portal-relative (e.g. "/tutor/tutor_available_times/index/1").
+type PortalClient interface {
+	// Login starts a new session for the given tutor credentials.
+	Login(username, password string) error
+	// FetchAvailability returns the HTML of the tutor availability overview page.
+	FetchAvailability() (string, error)
+	// FetchTerm returns the HTML of a term's availability page.
+	FetchTerm(termPath string) (string, error)
+	// FetchWeekAvailability returns the HTML of a single week's availability page.
+	FetchWeekAvailability(weekPath string) (string, error)
+	// FetchWeekSchedule returns the HTML of the timetable for a week of a term.
+	FetchWeekSchedule(year string, term, week int) (string, error)
+	// Logout ends the current session.
+	Logout() error
+}
+
+// NewPortalClient creates the portal client selected by the common config, along with a
+// function that releases any resources it holds.
+func NewPortalClient(commonCfg *config.CommonConfig) (PortalClient, func(), error) {
+	switch commonCfg.PortalBackend {
+	case "", "http":
+		return NewHTTPClient(commonCfg.PortalBaseURL), func() {}, nil
+	case "playwright":
+		// Initialize Playwright
+		pw, err := playwright.Run()
+		if err != nil {
+			return nil, nil, fmt.Errorf("couldn't start Playwright: %v", err)
+		}
+
+		// Set up the browser
+		browser, err := pw.Chromium.Launch(playwright.BrowserTypeLaunchOptions{
+			Headless: playwright.Bool(true), // Set to false if you want to see the browser in action
+		})
+		if err != nil {
+			pw.Stop()
+			return nil, nil, fmt.Errorf("could not launch browser: %v", err)
+		}
+
+		closeClient := func() {
+			browser.Close()
+			pw.Stop()
+		}
+		return NewPlaywrightClient(browser, commonCfg.PortalBaseURL), closeClient, nil
+	case "fixtures":
+		if commonCfg.PortalFixturesDir == "" {
+			return nil, nil, fmt.Errorf("portal_fixtures_dir must be set for the fixtures backend")
+		}
+		return NewFixtureClient(commonCfg.PortalFixturesDir), func() {}, nil
+	default:
+		return nil, nil, fmt.Errorf("unknown portal backend: %s", commonCfg.PortalBackend)
+	}
+}
+
+// weekSchedulePathFor builds the portal path of the timetable for a week of a term.
+func weekSchedulePathFor(year string, term, week int) string {
+	return fmt.Sprintf("%s/year:%s/term:%d/week:%d", weekSchedulePath, year, term, week)
+}
+
+// portalURL returns the portal base URL to use, falling back to the live FunTech portal.
+func portalURL(baseURL string) string {
+	if baseURL == "" {
+		return defaultPortalURL
+	}
+	return strings.TrimSuffix(baseURL, "/")
+}
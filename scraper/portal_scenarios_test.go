@@ -0,0 +1,109 @@
+package scraper
+
+import (
+	"path/filepath"
+	"testing"
+
+	"funtech-scraper/scraper/portaltest"
+)
+
+// startScenario serves the scenario recorded in testdata/scenarios and returns a client for it.
+func startScenario(t *testing.T, name string) *HTTPClient {
+	t.Helper()
+	scenario, err := portaltest.LoadScenario(filepath.Join("testdata", "scenarios", name+".json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv, _ := portaltest.NewServer(scenario)
+	t.Cleanup(srv.Close)
+	return NewHTTPClient(srv.URL)
+}
+
+func TestScenarioFailedLogin(t *testing.T) {
+	tests := []struct {
+		name     string
+		username string
+		password string
+	}{
+		{name: "wrong password", username: "tutor", password: "wrong"},
+		{name: "unknown user", username: "nobody", password: "secret"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := startScenario(t, "basic")
+			if err := client.Login(tt.username, tt.password); err == nil {
+				t.Fatalf("Login succeeded, want it rejected")
+			}
+			if _, err := ScrapeAllLessonsWithClient(client, tt.username, tt.password); err == nil {
+				t.Fatalf("ScrapeAllLessonsWithClient succeeded, want an error")
+			}
+		})
+	}
+}
+
+func TestScenarioWeeks(t *testing.T) {
+	tests := []struct {
+		scenario     string
+		wantStatuses []ScrapeStatus
+		wantLessons  int
+	}{
+		{scenario: "basic", wantStatuses: []ScrapeStatus{ScrapeOK, ScrapeOK}, wantLessons: 3},
+		{scenario: "empty_week", wantStatuses: []ScrapeStatus{ScrapeOK, ScrapeEmpty}, wantLessons: 1},
+		{scenario: "changed_markup", wantStatuses: []ScrapeStatus{ScrapeFailed}, wantLessons: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.scenario, func(t *testing.T) {
+			client := startScenario(t, tt.scenario)
+			results, err := ScrapeAllLessonsWithClient(client, "tutor", "secret")
+			if err != nil {
+				t.Fatalf("ScrapeAllLessonsWithClient: %v", err)
+			}
+
+			var statuses []ScrapeStatus
+			for _, result := range results {
+				statuses = append(statuses, result.Status)
+			}
+			if len(statuses) != len(tt.wantStatuses) {
+				t.Fatalf("statuses = %v, want %v", statuses, tt.wantStatuses)
+			}
+			for i := range statuses {
+				if statuses[i] != tt.wantStatuses[i] {
+					t.Errorf("week %d status = %v, want %v", i+1, statuses[i], tt.wantStatuses[i])
+				}
+			}
+			if lessons := LessonsFromResults(results); len(lessons) != tt.wantLessons {
+				t.Errorf("got %d lessons, want %d", len(lessons), tt.wantLessons)
+			}
+		})
+	}
+}
+
+func TestScenarioChangedMarkupIsUntrusted(t *testing.T) {
+	client := startScenario(t, "changed_markup")
+	results, err := ScrapeAllLessonsWithClient(client, "tutor", "secret")
+	if err != nil {
+		t.Fatalf("ScrapeAllLessonsWithClient: %v", err)
+	}
+	if len(results) != 1 {
+		t.Fatalf("got %d results, want 1", len(results))
+	}
+	if len(results[0].Warnings) != 2 {
+		t.Errorf("got %d warnings, want one per lesson row", len(results[0].Warnings))
+	}
+	if !UntrustedWeeks(results)[results[0].Week.Key()] {
+		t.Errorf("week with changed markup is trusted, want its events kept")
+	}
+}
+
+func TestScenarioChangedAvailabilityMarkup(t *testing.T) {
+	client := startScenario(t, "changed_availability")
+	terms, weeksByTerm, year := ScrapeAvailabilityWithClient(client, "tutor", "secret")
+	if terms != nil || weeksByTerm != nil || year != "" {
+		t.Fatalf("ScrapeAvailabilityWithClient = %v, %v, %q, want nothing", terms, weeksByTerm, year)
+	}
+	if _, err := ScrapeAllLessonsWithClient(client, "tutor", "secret"); err == nil {
+		t.Fatalf("ScrapeAllLessonsWithClient succeeded, want an error")
+	}
+}
@@ -0,0 +1,311 @@
+// Package portaltest provides a fake FunTech tutor portal for end-to-end testing of the scraper.
+package portaltest
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"html"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const sessionCookie = "CAKEPHP"
+
+// Scenario describes the portal state served by the fake.
+type Scenario struct {
+	Users map[string]string `json:"users"` // Username -> password accepted by the login form
+	Year  string            `json:"year"`  // Academic year, e.g. "2024-25"
+	Terms []Term            `json:"terms"`
+	// Pages overrides the HTML served for a path (e.g. to simulate changed markup).
+	// An empty string responds with 500 Internal Server Error instead.
+	Pages map[string]string `json:"pages"`
+}
+
+// Term is a tab on the availability page. The tab named "Term Time" is rendered with
+// week columns linking to each week's page; any other term is rendered as a holiday
+// term with one row per week.
+type Term struct {
+	Name  string `json:"name"`
+	Index int    `json:"index"`
+	Weeks []Week `json:"weeks"`
+}
+
+// Week is a week of a term. Weeks are numbered from 1 in the order they are listed.
+type Week struct {
+	StartDate string   `json:"start_date"` // dd/mm/yyyy
+	Lessons   []Lesson `json:"lessons"`
+}
+
+// Lesson is a lesson panel on a week's timetable.
+type Lesson struct {
+	Course string `json:"course"` // e.g. "Python"
+	Group  string `json:"group"`  // e.g. "L2"
+	Day    string `json:"day"`    // Abbreviated weekday, e.g. "Thu"
+	Start  string `json:"start"`  // e.g. "16:00"
+	End    string `json:"end"`    // e.g. "17:00"
+	Type   int    `json:"type"`   // 0-3, rendered as the panel's colour
+	// Title overrides the panel title, e.g. to simulate a malformed row.
+	Title string `json:"title,omitempty"`
+}
+
+// Portal is an http.Handler that serves a fake tutor portal from a scenario.
+type Portal struct {
+	mu       sync.Mutex
+	scenario Scenario
+	sessions map[string]string
+	requests []string
+}
+
+// NewPortal creates a fake portal serving the given scenario.
+func NewPortal(scenario Scenario) *Portal {
+	return &Portal{scenario: scenario, sessions: make(map[string]string)}
+}
+
+// NewServer starts an httptest server for a fake portal serving the given scenario.
+// The caller should call Close when finished.
+func NewServer(scenario Scenario) (*httptest.Server, *Portal) {
+	portal := NewPortal(scenario)
+	return httptest.NewServer(portal), portal
+}
+
+// LoadScenario reads a scenario from a JSON file.
+func LoadScenario(filename string) (Scenario, error) {
+	var scenario Scenario
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return scenario, err
+	}
+	if err := json.Unmarshal(data, &scenario); err != nil {
+		return scenario, fmt.Errorf("error decoding scenario %s: %v", filename, err)
+	}
+	return scenario, nil
+}
+
+// SetScenario replaces the served scenario, keeping existing sessions.
+func (p *Portal) SetScenario(scenario Scenario) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.scenario = scenario
+}
+
+// Requests returns the paths requested so far, in order.
+func (p *Portal) Requests() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]string(nil), p.requests...)
+}
+
+func (p *Portal) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.requests = append(p.requests, r.URL.Path)
+
+	if page, ok := p.scenario.Pages[r.URL.Path]; ok {
+		if page == "" {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		writePage(w, page)
+		return
+	}
+
+	switch {
+	case r.URL.Path == "/tutors":
+		p.handleLogin(w, r)
+		return
+	case r.URL.Path == "/tutor/tutors/logout":
+		if cookie, err := r.Cookie(sessionCookie); err == nil {
+			delete(p.sessions, cookie.Value)
+		}
+		http.Redirect(w, r, "/tutors", http.StatusFound)
+		return
+	}
+
+	// Everything else requires a session
+	if cookie, err := r.Cookie(sessionCookie); err != nil || p.sessions[cookie.Value] == "" {
+		http.Redirect(w, r, "/tutors", http.StatusFound)
+		return
+	}
+
+	path := r.URL.Path
+	switch {
+	case path == "/tutor" || path == "/tutor/":
+		writePage(w, "<h1>Tutor Dashboard</h1>")
+	case path == "/tutor/tutor_available_times":
+		writePage(w, p.availabilityPage())
+	case strings.HasPrefix(path, "/tutor/tutor_available_times/index/"):
+		term, ok := p.term(strings.TrimPrefix(path, "/tutor/tutor_available_times/index/"))
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		writePage(w, p.termPage(term))
+	case strings.HasPrefix(path, "/tutor/tutor_available_times/availability/"):
+		parts := strings.Split(strings.TrimPrefix(path, "/tutor/tutor_available_times/availability/"), "/")
+		if len(parts) != 2 {
+			http.NotFound(w, r)
+			return
+		}
+		term, ok := p.term(parts[0])
+		weekNumber, err := strconv.Atoi(parts[1])
+		if !ok || err != nil || weekNumber < 1 || weekNumber > len(term.Weeks) {
+			http.NotFound(w, r)
+			return
+		}
+		writePage(w, p.weekAvailabilityPage(term, weekNumber))
+	case strings.HasPrefix(path, "/tutor/tutors/tt_week_schedule/"):
+		writePage(w, p.weekSchedulePage(strings.TrimPrefix(path, "/tutor/tutors/tt_week_schedule/")))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// handleLogin serves the login form and starts a session for valid credentials.
+func (p *Portal) handleLogin(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writePage(w, loginForm(""))
+		return
+	}
+
+	username := r.FormValue("data[Tutor][username]")
+	password := r.FormValue("data[Tutor][password]")
+	expected, ok := p.scenario.Users[username]
+	if !ok || expected != password {
+		writePage(w, loginForm("Invalid username or password, try again"))
+		return
+	}
+
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	sessionID := hex.EncodeToString(id)
+	p.sessions[sessionID] = username
+	http.SetCookie(w, &http.Cookie{Name: sessionCookie, Value: sessionID, Path: "/"})
+	http.Redirect(w, r, "/tutor", http.StatusFound)
+}
+
+// term finds a term of the scenario by its index in a URL.
+func (p *Portal) term(index string) (Term, bool) {
+	for _, term := range p.scenario.Terms {
+		if strconv.Itoa(term.Index) == index {
+			return term, true
+		}
+	}
+	return Term{}, false
+}
+
+func (p *Portal) availabilityPage() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, `<h1 class="no-margin-top">Availability <small>Year %s</small></h1>`, html.EscapeString(p.scenario.Year))
+	b.WriteString(`<ul class="nav nav-tabs">`)
+	for _, term := range p.scenario.Terms {
+		fmt.Fprintf(&b, `<li><a href="/tutor/tutor_available_times/index/%d">%s</a></li>`, term.Index, html.EscapeString(term.Name))
+	}
+	b.WriteString(`</ul>`)
+	return b.String()
+}
+
+func (p *Portal) termPage(term Term) string {
+	var b strings.Builder
+	b.WriteString(`<table class="table"><tbody>`)
+	if term.Name == "Term Time" {
+		b.WriteString(`<tr>`)
+		for i := range term.Weeks {
+			fmt.Fprintf(&b, `<td class="text-center"><div class="dropdown"><ul class="dropdown-menu">`+
+				`<li><a href="/tutor/tutor_available_times/availability/%d/%d">View</a></li>`+
+				`<li><a href="#">Edit</a></li></ul></div></td>`, term.Index, i+1)
+		}
+		b.WriteString(`</tr>`)
+	} else {
+		for i, week := range term.Weeks {
+			fmt.Fprintf(&b, `<tr><th>%s</th><td><div class="dropdown"><ul class="dropdown-menu">`+
+				`<li><a href="/tutor/tutor_available_times/availability/%d/%d">View</a></li></ul></div></td></tr>`,
+				html.EscapeString(week.StartDate), term.Index, i+1)
+		}
+	}
+	b.WriteString(`</tbody></table>`)
+	return b.String()
+}
+
+func (p *Portal) weekAvailabilityPage(term Term, weekNumber int) string {
+	startDate := term.Weeks[weekNumber-1].StartDate
+	endDate := startDate
+	if start, err := time.Parse("02/01/2006", startDate); err == nil {
+		endDate = start.AddDate(0, 0, 6).Format("02/01/2006")
+	}
+	return fmt.Sprintf(`<div class="page-header"><h1>Availability</h1><p>Year %s | Term %d | Week %d | %s - %s</p></div>`,
+		html.EscapeString(p.scenario.Year), term.Index, weekNumber, html.EscapeString(startDate), html.EscapeString(endDate))
+}
+
+// weekSchedulePage renders the timetable for a path such as "year:2024-25/term:1/week:3".
+// Unknown weeks are rendered as an empty timetable, as the portal does.
+func (p *Portal) weekSchedulePage(params string) string {
+	values := map[string]string{}
+	for _, part := range strings.Split(params, "/") {
+		if key, value, ok := strings.Cut(part, ":"); ok {
+			values[key] = value
+		}
+	}
+
+	var lessons []Lesson
+	if values["year"] == p.scenario.Year {
+		if term, ok := p.term(values["term"]); ok {
+			if weekNumber, err := strconv.Atoi(values["week"]); err == nil && weekNumber >= 1 && weekNumber <= len(term.Weeks) {
+				lessons = term.Weeks[weekNumber-1].Lessons
+			}
+		}
+	}
+
+	var b strings.Builder
+	b.WriteString(`<h1>Week Schedule</h1>`)
+	for _, lesson := range lessons {
+		title := lesson.Title
+		if title == "" {
+			title = fmt.Sprintf("%s • %s • %s • %s - %s", lesson.Course, lesson.Group, lesson.Day, lesson.Start, lesson.End)
+		}
+		fmt.Fprintf(&b, `<div class="panel %s"><div class="panel-heading"><h4 class="panel-title"><span>%s</span></h4></div></div>`,
+			panelClass(lesson.Type), html.EscapeString(title))
+	}
+	return b.String()
+}
+
+// panelClass maps a lesson type to the panel class the portal uses for it.
+func panelClass(lessonType int) string {
+	switch lessonType {
+	case 1:
+		return "panel-info"
+	case 2:
+		return "panel-warning"
+	case 3:
+		return "panel-danger"
+	default:
+		return "panel-default"
+	}
+}
+
+func loginForm(message string) string {
+	var b strings.Builder
+	if message != "" {
+		fmt.Fprintf(&b, `<div class="alert alert-danger">%s</div>`, html.EscapeString(message))
+	}
+	b.WriteString(`<form action="/tutors" method="post">` +
+		`<input type="hidden" name="_method" value="POST">` +
+		`<input type="text" name="data[Tutor][username]">` +
+		`<input type="password" name="data[Tutor][password]">` +
+		`<button type="submit">Login</button></form>`)
+	return b.String()
+}
+
+func writePage(w http.ResponseWriter, body string) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprintf(w, "<!DOCTYPE html><html><head><title>FunTech</title></head><body>%s</body></html>", body)
+}
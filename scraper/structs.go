@@ -1,6 +1,10 @@
 package scraper
 
-import "time"
+import (
+	"fmt"
+	"strings"
+	"time"
+)
 
 // Term represents a term in the availability (e.g., Term Time, Summer, Easter, Xmas).
 type Term struct {
@@ -10,6 +14,7 @@ type Term struct {
 
 // Week represents a specific week within a term and its date range.
 type Week struct {
+	Year       string
 	Term       int
 	WeekNumber int
 	StartDate  string
@@ -18,6 +23,8 @@ type Week struct {
 
 // Lesson represents a lesson schedule.
 type Lesson struct {
+	Key        string // Stable identity of the lesson, see LessonKey
+	WeekKey    string // Key of the week the lesson was scraped from, see Week.Key
 	Course     string
 	Day        string
 	StartTime  string
@@ -25,3 +32,69 @@ type Lesson struct {
 	Date       time.Time
 	LessonType int
 }
+
+// ScrapeStatus is the outcome of scraping a week's timetable.
+type ScrapeStatus string
+
+const (
+	ScrapeOK     ScrapeStatus = "ok"     // The week was scraped and has lessons
+	ScrapeEmpty  ScrapeStatus = "empty"  // The week was scraped and has no lessons
+	ScrapeFailed ScrapeStatus = "failed" // The week could not be fetched or parsed
+)
+
+// ScrapeResult is the outcome of scraping a single week.
+type ScrapeResult struct {
+	Week      Week
+	Status    ScrapeStatus
+	Err       error
+	FetchedAt time.Time
+	Lessons   []Lesson
+	Warnings  []ParseWarning
+}
+
+// LessonsFromResults collects the lessons of all scraped weeks.
+func LessonsFromResults(results []ScrapeResult) []Lesson {
+	var lessons []Lesson
+	for _, result := range results {
+		lessons = append(lessons, result.Lessons...)
+	}
+	return lessons
+}
+
+// UntrustedWeeks returns the keys of weeks whose lessons may be incomplete: weeks that failed and
+// weeks with skipped rows. The sync must not treat lessons missing from them as cancelled.
+func UntrustedWeeks(results []ScrapeResult) map[string]bool {
+	weeks := make(map[string]bool)
+	for _, result := range results {
+		if result.Status == ScrapeFailed || len(result.Warnings) > 0 {
+			weeks[result.Week.Key()] = true
+		}
+	}
+	return weeks
+}
+
+// Key identifies the week across scrapes. Holiday weeks can share term and week numbers,
+// so the start date is included.
+func (w Week) Key() string {
+	startDate := w.StartDate
+	if parsed, err := time.Parse("02/01/2006", w.StartDate); err == nil {
+		startDate = parsed.Format("2006-01-02")
+	}
+	return fmt.Sprintf("%s/%d/%d/%s", w.Year, w.Term, w.WeekNumber, startDate)
+}
+
+// LessonKey builds the stable identity of a lesson from its week, day and course. The slot
+// tells apart lessons of the same course on the same day, in the order the portal lists them.
+// Start and end times are deliberately left out so a rescheduled lesson keeps its key.
+func LessonKey(week Week, day, course string, slot int) string {
+	return fmt.Sprintf("%s/%s/%s/%d", week.Key(), day, course, slot)
+}
+
+// lessonWeekKey returns the key of the week a lesson key belongs to.
+func lessonWeekKey(lessonKey string) string {
+	parts := strings.SplitN(lessonKey, "/", 5)
+	if len(parts) < 5 {
+		return ""
+	}
+	return strings.Join(parts[:4], "/")
+}
@@ -0,0 +1,267 @@
+package scraper
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// CalendarEvent is an event in the target calendar as seen by the sync.
+type CalendarEvent struct {
+	ID         string // Identifier assigned by the calendar; empty for events not created yet
+	Key        string // Lesson key of a managed event
+	Summary    string
+	Start      time.Time
+	End        time.Time
+	LessonType int
+	Managed    bool // Whether the event was created by the sync
+}
+
+// EventUpdate is a change to an existing event.
+type EventUpdate struct {
+	Old CalendarEvent
+	New CalendarEvent
+}
+
+// SyncPlan lists the changes needed to bring a calendar in line with the scraped lessons.
+type SyncPlan struct {
+	Inserts      []CalendarEvent
+	Updates      []EventUpdate
+	Deletes      []CalendarEvent
+	ManagedCount int // Number of managed events in the calendar before the plan is applied
+	Kept         int // Number of missing lessons kept because their week could not be fully scraped
+	// Adoptable is the number of events not created by the sync that exactly match a lesson. They
+	// are left alone, and the lesson is not added, until the user agrees to adopt them.
+	Adoptable int
+}
+
+// SyncOptions controls how lessons are synced into a calendar.
+type SyncOptions struct {
+	ClearAll bool // Delete all synced events before syncing
+	DryRun   bool // Only plan the changes, without making them
+	// MaxDeleteFraction refuses plans that would delete more than this share of the synced
+	// events in the calendar. Zero disables the check.
+	MaxDeleteFraction float64
+	// AdoptUntagged takes over events not created by the sync that exactly match a lesson, as
+	// needed once for calendars synced before lesson keys were stored on events.
+	AdoptUntagged bool
+}
+
+// SyncBlockedError is returned when a sync is refused because it would delete too many events.
+type SyncBlockedError struct {
+	Reason string
+}
+
+func (e *SyncBlockedError) Error() string {
+	return "sync blocked: " + e.Reason
+}
+
+// CheckSyncPlan refuses a plan that would delete more than maxDeleteFraction of the synced events
+// in the calendar, which usually means the scrape came back empty or partial.
+func CheckSyncPlan(plan *SyncPlan, maxDeleteFraction float64) error {
+	return CheckDeleteFraction(len(plan.Deletes), plan.ManagedCount, maxDeleteFraction, "synced events")
+}
+
+// CheckDeleteFraction refuses deleting more than maxDeleteFraction of total items, described by
+// what in the error. Zero disables the check.
+func CheckDeleteFraction(deletes, total int, maxDeleteFraction float64, what string) error {
+	if maxDeleteFraction <= 0 || total == 0 || deletes == 0 {
+		return nil
+	}
+
+	fraction := float64(deletes) / float64(total)
+	if fraction > maxDeleteFraction {
+		return &SyncBlockedError{Reason: fmt.Sprintf("would delete %d of %d %s (%.0f%%, limit %.0f%%)",
+			deletes, total, what, fraction*100, maxDeleteFraction*100)}
+	}
+	return nil
+}
+
+// Empty reports whether the plan makes no changes.
+func (p *SyncPlan) Empty() bool {
+	return len(p.Inserts) == 0 && len(p.Updates) == 0 && len(p.Deletes) == 0
+}
+
+// String renders the plan as a human-readable diff.
+func (p *SyncPlan) String() string {
+	if p.Empty() && p.Adoptable == 0 {
+		return "No changes.\n"
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d to insert, %d to update, %d to delete (%d synced events in calendar)\n",
+		len(p.Inserts), len(p.Updates), len(p.Deletes), p.ManagedCount)
+	for _, event := range p.Inserts {
+		fmt.Fprintf(&b, "+ %s\n", event.Describe())
+	}
+	for _, update := range p.Updates {
+		fmt.Fprintf(&b, "~ %s\n  -> %s\n", update.Old.Describe(), update.New.Describe())
+	}
+	for _, event := range p.Deletes {
+		fmt.Fprintf(&b, "- %s\n", event.Describe())
+	}
+	if p.Kept > 0 {
+		fmt.Fprintf(&b, "%d events kept because their week could not be fully scraped\n", p.Kept)
+	}
+	if p.Adoptable > 0 {
+		fmt.Fprintf(&b, "%d events not created by the sync match lessons and were left alone\n", p.Adoptable)
+	}
+	return b.String()
+}
+
+// Describe formats an event as e.g. "Thu 26 Sep 2024 16:00-17:00 Python L2".
+func (e CalendarEvent) Describe() string {
+	loc, _ := time.LoadLocation("Europe/London")
+	start := e.Start.In(loc)
+	return fmt.Sprintf("%s %s-%s %s", start.Format("Mon 02 Jan 2006"), start.Format("15:04"), e.End.In(loc).Format("15:04"), e.Summary)
+}
+
+// LessonToEvent builds the managed calendar event for a lesson.
+func LessonToEvent(lesson Lesson) (CalendarEvent, error) {
+	start, end, err := getEventTimes(lesson.Date, lesson.StartTime, lesson.EndTime)
+	if err != nil {
+		return CalendarEvent{}, err
+	}
+
+	// Ensure the end time is after the start time
+	if !end.After(start) {
+		end = start.Add(time.Hour) // Adjust end time to be one hour after start time
+	}
+
+	return CalendarEvent{
+		Key:        lesson.Key,
+		Summary:    lesson.Course,
+		Start:      start,
+		End:        end,
+		LessonType: lesson.LessonType,
+		Managed:    true,
+	}, nil
+}
+
+// BuildSyncPlan compares the events in a calendar with the scraped lessons. Managed events are
+// matched to lessons by lesson key, or else by time slot when the lesson in it changed course. Unmanaged events are never touched unless adoptUntagged is set
+// and they exactly match a lesson, which adopts events created before lesson keys were stored.
+// Events in weeks that could not be fully scraped are never deleted.
+func BuildSyncPlan(existingEvents []CalendarEvent, results []ScrapeResult, adoptUntagged bool) *SyncPlan {
+	plan := &SyncPlan{}
+	lessons := LessonsFromResults(results)
+	untrustedWeeks := UntrustedWeeks(results)
+
+	// Map existing managed events by their lesson key, and unmanaged events by their summary and times
+	existingEventsMap := make(map[string]CalendarEvent)
+	legacyEventsMap := make(map[string]CalendarEvent)
+	for _, event := range existingEvents {
+		if !event.Managed {
+			legacyEventsMap[legacyEventID(event)] = event
+			continue
+		}
+		plan.ManagedCount++
+		if _, found := existingEventsMap[event.Key]; found || event.Key == "" {
+			// Duplicated or unidentifiable managed events are removed
+			plan.Deletes = append(plan.Deletes, event)
+			continue
+		}
+		existingEventsMap[event.Key] = event
+	}
+
+	lessonsMap := make(map[string]CalendarEvent)
+	for _, lesson := range lessons {
+		event, err := LessonToEvent(lesson)
+		if err != nil {
+			fmt.Printf("Error parsing event times: %v\n", err)
+			continue
+		}
+		if _, found := lessonsMap[lesson.Key]; found {
+			fmt.Printf("Skipping lesson with duplicate key: %s\n", lesson.Key)
+			continue
+		}
+		lessonsMap[lesson.Key] = event
+	}
+
+	var unmatched []CalendarEvent
+	for _, key := range sortedKeys(lessonsMap) {
+		event := lessonsMap[key]
+		existingEvent, found := existingEventsMap[key]
+		if !found {
+			legacyID := legacyEventID(event)
+			existingEvent, found = legacyEventsMap[legacyID]
+			delete(legacyEventsMap, legacyID)
+
+			// Leave a matching event the user may have made themselves alone rather than add a copy
+			if found && !adoptUntagged {
+				plan.Adoptable++
+				continue
+			}
+		}
+
+		if !found {
+			unmatched = append(unmatched, event)
+			continue
+		}
+
+		event.ID = existingEvent.ID
+		if !existingEvent.Managed || existingEvent.Key != event.Key || existingEvent.Summary != event.Summary || existingEvent.LessonType != event.LessonType ||
+			!existingEvent.Start.Equal(event.Start) || !existingEvent.End.Equal(event.End) {
+			plan.Updates = append(plan.Updates, EventUpdate{Old: existingEvent, New: event})
+		}
+	}
+
+	// Managed events that are not in the lessons data are gone, unless their week may be incomplete
+	var orphans []CalendarEvent
+	for _, key := range sortedKeys(existingEventsMap) {
+		if _, found := lessonsMap[key]; !found {
+			if untrustedWeeks[lessonWeekKey(key)] {
+				plan.Kept++
+				continue
+			}
+			orphans = append(orphans, existingEventsMap[key])
+		}
+	}
+
+	// A new lesson in the slot of a gone one, such as a renamed course, takes over its event so
+	// anything the tutor added to it is kept
+	for _, event := range unmatched {
+		i := sameSlot(orphans, event)
+		if i < 0 {
+			plan.Inserts = append(plan.Inserts, event)
+			continue
+		}
+		existingEvent := orphans[i]
+		orphans = append(orphans[:i], orphans[i+1:]...)
+		event.ID = existingEvent.ID
+		plan.Updates = append(plan.Updates, EventUpdate{Old: existingEvent, New: event})
+	}
+	plan.Deletes = append(plan.Deletes, orphans...)
+
+	return plan
+}
+
+// sameSlot returns the index of the first event with the same times as event, or -1.
+func sameSlot(events []CalendarEvent, event CalendarEvent) int {
+	for i, other := range events {
+		if other.Start.Equal(event.Start) && other.End.Equal(event.End) {
+			return i
+		}
+	}
+	return -1
+}
+
+// legacyEventID hashes an event's summary and times. It identified events before lesson keys were
+// stored on them and is now only used to adopt those older events.
+func legacyEventID(event CalendarEvent) string {
+	hash := md5.New()
+	hash.Write([]byte(event.Summary + event.Start.UTC().Format(time.RFC3339) + event.End.UTC().Format(time.RFC3339)))
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+func sortedKeys(events map[string]CalendarEvent) []string {
+	keys := make([]string, 0, len(events))
+	for key := range events {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
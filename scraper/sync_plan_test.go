@@ -0,0 +1,255 @@
+package scraper
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testWeek builds the result of fully scraping the week of testLesson with the given lessons.
+func testWeek(lessons ...Lesson) []ScrapeResult {
+	week := Week{Year: "2024-25", Term: 1, WeekNumber: 1, StartDate: "23/09/2024"}
+	status := ScrapeOK
+	if len(lessons) == 0 {
+		status = ScrapeEmpty
+	}
+	return []ScrapeResult{{Week: week, Status: status, Lessons: lessons}}
+}
+
+func TestBuildSyncPlanAdoptsUntaggedOnlyWhenAsked(t *testing.T) {
+	week := Week{Year: "2024-25", Term: 1, WeekNumber: 1, StartDate: "23/09/2024"}
+	lesson := Lesson{
+		Key:       LessonKey(week, "Thursday", "Python L2", 0),
+		WeekKey:   week.Key(),
+		Course:    "Python L2",
+		Day:       "Thursday",
+		StartTime: "16:00",
+		EndTime:   "17:00",
+		Date:      time.Date(2024, time.September, 26, 0, 0, 0, 0, time.UTC),
+	}
+	results := []ScrapeResult{{Week: week, Status: ScrapeOK, Lessons: []Lesson{lesson}}}
+
+	untagged, err := LessonToEvent(lesson)
+	if err != nil {
+		t.Fatal(err)
+	}
+	untagged.ID, untagged.Key, untagged.Managed = "old", "", false
+
+	tests := []struct {
+		name          string
+		adoptUntagged bool
+		wantUpdates   int
+		wantInserts   int
+		wantAdoptable int
+	}{
+		{name: "left alone", adoptUntagged: false, wantAdoptable: 1},
+		{name: "adopted", adoptUntagged: true, wantUpdates: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plan := BuildSyncPlan([]CalendarEvent{untagged}, results, tt.adoptUntagged)
+			if len(plan.Updates) != tt.wantUpdates || len(plan.Inserts) != tt.wantInserts || plan.Adoptable != tt.wantAdoptable {
+				t.Errorf("plan has %d updates, %d inserts, %d adoptable; want %d, %d, %d",
+					len(plan.Updates), len(plan.Inserts), plan.Adoptable, tt.wantUpdates, tt.wantInserts, tt.wantAdoptable)
+			}
+			if len(plan.Deletes) != 0 {
+				t.Errorf("plan deletes %d events, want none", len(plan.Deletes))
+			}
+			if tt.adoptUntagged && plan.Updates[0].Old.ID != "old" {
+				t.Errorf("adopted event %q, want %q", plan.Updates[0].Old.ID, "old")
+			}
+		})
+	}
+}
+
+func TestCheckSyncPlan(t *testing.T) {
+	events := func(n int) []CalendarEvent {
+		events := make([]CalendarEvent, n)
+		for i := range events {
+			events[i] = testEvent(i, "Python L2")
+		}
+		return events
+	}
+
+	tests := []struct {
+		name              string
+		plan              SyncPlan
+		maxDeleteFraction float64
+		wantBlocked       bool
+	}{
+		{name: "nothing deleted", plan: SyncPlan{ManagedCount: 10}, maxDeleteFraction: 0.5},
+		{name: "at the limit", plan: SyncPlan{ManagedCount: 10, Deletes: events(5)}, maxDeleteFraction: 0.5},
+		{name: "just over the limit", plan: SyncPlan{ManagedCount: 10, Deletes: events(6)}, maxDeleteFraction: 0.5, wantBlocked: true},
+		{name: "everything deleted", plan: SyncPlan{ManagedCount: 10, Deletes: events(10)}, maxDeleteFraction: 0.5, wantBlocked: true},
+		{name: "empty calendar", plan: SyncPlan{Inserts: events(10)}, maxDeleteFraction: 0.5},
+		{name: "approved", plan: SyncPlan{ManagedCount: 10, Deletes: events(10)}, maxDeleteFraction: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CheckSyncPlan(&tt.plan, tt.maxDeleteFraction)
+			if !tt.wantBlocked {
+				if err != nil {
+					t.Fatalf("CheckSyncPlan = %v, want nil", err)
+				}
+				return
+			}
+			var blocked *SyncBlockedError
+			if !errors.As(err, &blocked) {
+				t.Fatalf("CheckSyncPlan = %v, want *SyncBlockedError", err)
+			}
+			if !strings.Contains(blocked.Reason, fmt.Sprintf("would delete %d of 10 synced events", len(tt.plan.Deletes))) {
+				t.Errorf("reason = %q", blocked.Reason)
+			}
+		})
+	}
+}
+
+func TestSyncLessonsBlocksMassDeletion(t *testing.T) {
+	lessons := []Lesson{
+		testLesson("Python L2", 0, "16:00", "17:00"),
+		testLesson("Python L2", 1, "16:00", "17:00"),
+		testLesson("Python L2", 2, "16:00", "17:00"),
+	}
+	sink := &ICSFileSink{Path: filepath.Join(t.TempDir(), "lessons.ics")}
+	if _, err := SyncLessons(sink, testWeek(lessons...), SyncOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Every week coming back empty must not empty the calendar
+	plan, err := SyncLessons(sink, testWeek(), SyncOptions{MaxDeleteFraction: 0.5})
+	var blocked *SyncBlockedError
+	if !errors.As(err, &blocked) {
+		t.Fatalf("SyncLessons = %v, want *SyncBlockedError", err)
+	}
+	if len(plan.Deletes) != 3 {
+		t.Errorf("blocked plan has %d deletes, want 3", len(plan.Deletes))
+	}
+	if events, _ := sink.ListEvents(time.Time{}, time.Time{}); len(events) != 3 {
+		t.Errorf("calendar has %d events after a blocked sync, want 3", len(events))
+	}
+
+	// Once approved the same sync goes ahead
+	if _, err := SyncLessons(sink, testWeek(), SyncOptions{MaxDeleteFraction: 0}); err != nil {
+		t.Fatal(err)
+	}
+	if events, _ := sink.ListEvents(time.Time{}, time.Time{}); len(events) != 0 {
+		t.Errorf("calendar has %d events after an approved sync, want none", len(events))
+	}
+}
+
+func TestBuildSyncPlanKeepsEventsOfUntrustedWeeks(t *testing.T) {
+	// Lessons already synced for the week of 23/09 and the week after
+	nextWeek := Week{Year: "2024-25", Term: 1, WeekNumber: 2, StartDate: "30/09/2024"}
+	nextLesson := func(course string, day int) Lesson {
+		date := time.Date(2024, time.September, 30+day, 0, 0, 0, 0, time.UTC)
+		return Lesson{Key: LessonKey(nextWeek, date.Weekday().String(), course, 0), WeekKey: nextWeek.Key(),
+			Course: course, Day: date.Weekday().String(), StartTime: "16:00", EndTime: "17:00", Date: date}
+	}
+	synced := []Lesson{
+		testLesson("Python L2", 0, "16:00", "17:00"),
+		testLesson("Python L2", 3, "16:00", "17:00"),
+		nextLesson("Python L2", 0),
+		nextLesson("Scratch L1", 3),
+	}
+	var existing []CalendarEvent
+	for i, lesson := range synced {
+		event, err := LessonToEvent(lesson)
+		if err != nil {
+			t.Fatal(err)
+		}
+		event.ID = fmt.Sprintf("event%d", i)
+		existing = append(existing, event)
+	}
+
+	// The next week parsed without its Thursday lesson
+	parsed := ScrapeResult{Week: nextWeek, Status: ScrapeOK, Lessons: []Lesson{nextLesson("Python L2", 0)}}
+	failed := testWeek()[0]
+	failed.Status, failed.Err = ScrapeFailed, errors.New("timeout")
+	skippedRows := testWeek()[0]
+	skippedRows.Warnings = []ParseWarning{{}}
+
+	tests := []struct {
+		name      string
+		firstWeek ScrapeResult
+	}{
+		{name: "failed week", firstWeek: failed},
+		{name: "week with skipped rows", firstWeek: skippedRows},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plan := BuildSyncPlan(existing, []ScrapeResult{tt.firstWeek, parsed}, false)
+			if plan.Kept != 2 {
+				t.Errorf("plan keeps %d events, want the 2 of the untrusted week", plan.Kept)
+			}
+			if len(plan.Deletes) != 1 || plan.Deletes[0].ID != "event3" {
+				t.Errorf("plan deletes %v, want only the missing lesson of the parsed week", plan.Deletes)
+			}
+			if len(plan.Inserts) != 0 || len(plan.Updates) != 0 {
+				t.Errorf("plan has %d inserts and %d updates, want none", len(plan.Inserts), len(plan.Updates))
+			}
+		})
+	}
+}
+
+func TestSyncLessonsUpdatesChangedLessonsInPlace(t *testing.T) {
+	thursday := testLesson("Python L2", 3, "16:00", "17:00")
+	renamed := testLesson("Python L3", 3, "16:00", "17:00")
+	trial := thursday
+	trial.LessonType = 2
+
+	tests := []struct {
+		name    string
+		changed Lesson
+	}{
+		{name: "time changed", changed: testLesson("Python L2", 3, "17:00", "18:00")},
+		{name: "course changed", changed: renamed},
+		{name: "lesson type changed", changed: trial},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, fake := startCalendar(t)
+			sink := &GoogleSink{Client: client, CalendarID: testCalendarID}
+			if _, err := SyncLessons(sink, testWeek(thursday), SyncOptions{}); err != nil {
+				t.Fatal(err)
+			}
+			before := fake.Events(testCalendarID)
+			if len(before) != 1 {
+				t.Fatalf("calendar has %d events after the first sync, want 1", len(before))
+			}
+
+			plan, err := SyncLessons(sink, testWeek(tt.changed), SyncOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(plan.Updates) != 1 || len(plan.Inserts) != 0 || len(plan.Deletes) != 0 {
+				t.Fatalf("plan has %d updates, %d inserts, %d deletes; want a single update",
+					len(plan.Updates), len(plan.Inserts), len(plan.Deletes))
+			}
+
+			after := fake.Events(testCalendarID)
+			if len(after) != 1 || after[0].Id != before[0].Id {
+				t.Fatalf("calendar events changed from %s to %v, want the same event updated", before[0].Id, after)
+			}
+			event, ok := fromGoogleEvent(after[0])
+			if !ok {
+				t.Fatal("updated event cannot be read back")
+			}
+			want, err := LessonToEvent(tt.changed)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want.ID = after[0].Id
+			if event.Key != want.Key || event.Summary != want.Summary || event.LessonType != want.LessonType ||
+				!event.Start.Equal(want.Start) || !event.End.Equal(want.End) {
+				t.Errorf("updated event = %+v, want %+v", event, want)
+			}
+		})
+	}
+}
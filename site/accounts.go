@@ -0,0 +1,99 @@
+package site
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+
+	"funtech-scraper/config"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// minWebPasswordLength is the shortest password accepted for a web account.
+const minWebPasswordLength = 8
+
+// setWebPassword stores a bcrypt hash of the password the user logs in to the site with. It does not
+// save the config.
+func setWebPassword(userCfg *config.UserConfig, password string) error {
+	if len(password) < minWebPasswordLength {
+		return fmt.Errorf("the password must be at least %d characters", minWebPasswordLength)
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	userCfg.WebPasswordHash = string(hash)
+	return nil
+}
+
+// checkWebPassword reports whether the password is the user's web password. Accounts created before
+// web passwords existed log in with their FunTech password; migrated reports that such a login
+// succeeded and the FunTech password was copied into a web password hash, which the caller must save.
+func checkWebPassword(userCfg *config.UserConfig, password string) (ok, migrated bool) {
+	if userCfg.WebPasswordHash != "" {
+		return bcrypt.CompareHashAndPassword([]byte(userCfg.WebPasswordHash), []byte(password)) == nil, false
+	}
+
+	if userCfg.Password == "" || subtle.ConstantTimeCompare([]byte(userCfg.Password), []byte(password)) != 1 {
+		return false, false
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		log.Printf("Error hashing web password for user (%s): %v\n", userCfg.Username, err)
+		return true, false
+	}
+	userCfg.WebPasswordHash = string(hash)
+	return true, true
+}
+
+// ChangePasswordHandler changes the password the user logs in to the site with. The FunTech
+// password used by the scraper is changed on the dashboard form instead.
+func ChangePasswordHandler(w http.ResponseWriter, r *http.Request) {
+	log.Printf("Received request on /change_password from %s", r.RemoteAddr)
+	username, userCfg, _, ok := requirePost(w, r)
+	if !ok {
+		return
+	}
+
+	redirect := func(message string) {
+		http.Redirect(w, r, "/dashboard?message="+url.QueryEscape(message), http.StatusSeeOther)
+	}
+
+	if ok, _ := checkWebPassword(userCfg, r.FormValue("current_password")); !ok {
+		log.Printf("Wrong current password in password change for user: %s", userCfg.Username)
+		redirect("Your current password is not correct, so your password was not changed.")
+		return
+	}
+	newPassword := r.FormValue("new_password")
+	if newPassword != r.FormValue("confirm_password") {
+		redirect("The new passwords do not match, so your password was not changed.")
+		return
+	}
+	if err := setWebPassword(userCfg, newPassword); err != nil {
+		redirect(fmt.Sprintf("Your password was not changed: %v.", err))
+		return
+	}
+	_, err := updateUser(username, func(stored *config.UserConfig) error {
+		stored.WebPasswordHash = userCfg.WebPasswordHash
+		return nil
+	})
+	if err != nil {
+		log.Printf("Error saving new password for user (%s): %v\n", userCfg.Username, err)
+		http.Error(w, "Error saving password", http.StatusInternalServerError)
+		return
+	}
+
+	// Log out everywhere else, in case the old password was known to someone else
+	if _, err := dataStore.DeleteUserSessions(username); err != nil {
+		log.Printf("Error ending sessions of user (%s): %v\n", username, err)
+	}
+	if _, err := startSession(w, r, username); err != nil {
+		log.Printf("Error starting session for user (%s): %v\n", username, err)
+	}
+
+	log.Printf("Web password changed for user: %s", userCfg.Username)
+	redirect("Your password has been changed.")
+}
@@ -0,0 +1,92 @@
+package site
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"funtech-scraper/config"
+)
+
+func TestLegacyUserMovesToWebPassword(t *testing.T) {
+	setupSite(t)
+	addTestUser(t, "alice", &config.UserConfig{Username: "alice", Password: "funtech password"})
+
+	// Before web passwords, users logged in with their FunTech password
+	rec := logIn("alice", "funtech password")
+	if rec.Code != http.StatusSeeOther || !strings.Contains(rec.Header().Get("Location"), "message=") {
+		t.Fatalf("legacy login: status %d to %q, want a redirect asking for a new password", rec.Code, rec.Header().Get("Location"))
+	}
+	userCfg, _ := lookupUser("alice")
+	if userCfg.WebPasswordHash == "" || strings.Contains(userCfg.WebPasswordHash, "funtech password") {
+		t.Fatalf("web password hash = %q, want a bcrypt hash", userCfg.WebPasswordHash)
+	}
+	stored, err := userStore.Get("alice")
+	if err != nil || stored.WebPasswordHash != userCfg.WebPasswordHash {
+		t.Fatalf("saved web password hash = %q, %v, want it saved", stored.WebPasswordHash, err)
+	}
+
+	// The FunTech password still works until a separate password is chosen
+	cookie := sessionCookieFrom(t, logIn("alice", "funtech password"))
+	_, csrfToken, _, err := dataStore.SessionUser(cookie.Value)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	form := url.Values{
+		csrfField:          {csrfToken},
+		"current_password": {"funtech password"},
+		"new_password":     {"site password"},
+		"confirm_password": {"site password"},
+	}
+	rec = postForm(ChangePasswordHandler, "/change_password", cookie, form)
+	if location := rec.Header().Get("Location"); !strings.Contains(location, url.QueryEscape("has been changed")) {
+		t.Fatalf("change password redirected to %q, want it changed", location)
+	}
+
+	if rec := logIn("alice", "funtech password"); rec.Code != http.StatusUnauthorized {
+		t.Errorf("login with the FunTech password: status %d, want 401", rec.Code)
+	}
+	if rec := logIn("alice", "site password"); rec.Code != http.StatusSeeOther {
+		t.Errorf("login with the new password: status %d, want a redirect to the dashboard", rec.Code)
+	}
+	if userCfg, _ := lookupUser("alice"); userCfg.Password != "funtech password" {
+		t.Errorf("FunTech password changed to %q, want it kept for the scraper", userCfg.Password)
+	}
+}
+
+func TestChangePasswordChecksCurrentPassword(t *testing.T) {
+	setupSite(t)
+	userCfg := &config.UserConfig{Username: "alice", Password: "funtech password"}
+	if err := setWebPassword(userCfg, "site password"); err != nil {
+		t.Fatal(err)
+	}
+	addTestUser(t, "alice", userCfg)
+	cookie, csrfToken := startTestSession(t, "alice")
+
+	tests := []struct {
+		name    string
+		current string
+		new     string
+		confirm string
+	}{
+		{name: "wrong current password", current: "guess", new: "new password", confirm: "new password"},
+		{name: "FunTech password", current: "funtech password", new: "new password", confirm: "new password"},
+		{name: "confirmation differs", current: "site password", new: "new password", confirm: "other password"},
+		{name: "too short", current: "site password", new: "short", confirm: "short"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{csrfField: {csrfToken}, "current_password": {tt.current}, "new_password": {tt.new}, "confirm_password": {tt.confirm}}
+			rec := postForm(ChangePasswordHandler, "/change_password", cookie, form)
+			if location := rec.Header().Get("Location"); !strings.Contains(location, url.QueryEscape("not changed")) {
+				t.Errorf("redirected to %q, want the password not changed", location)
+			}
+			if rec := logIn("alice", "site password"); rec.Code != http.StatusSeeOther {
+				t.Errorf("login with the old password: status %d, want it still to work", rec.Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,101 @@
+package site
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"funtech-scraper/config"
+	"funtech-scraper/scraper"
+
+	ics "github.com/arran4/golang-ical"
+)
+
+// getFeed requests the feed with the token.
+func getFeed(token string) *httptest.ResponseRecorder {
+	return serve(FeedHandler, httptest.NewRequest(http.MethodGet, "/feed/"+token+".ics", nil), nil)
+}
+
+func TestFeedServesStoredLessons(t *testing.T) {
+	setupSite(t)
+	addTestUser(t, "alice", &config.UserConfig{Username: "alice"})
+	cookie, csrfToken := startTestSession(t, "alice")
+
+	week := scraper.Week{Year: "2024-25", Term: 1, WeekNumber: 1, StartDate: "23/09/2024"}
+	lesson := func(day string, date int, course, start, end string) scraper.Lesson {
+		return scraper.Lesson{
+			Key:       scraper.LessonKey(week, day, course, 0),
+			WeekKey:   week.Key(),
+			Course:    course,
+			Day:       day,
+			StartTime: start,
+			EndTime:   end,
+			Date:      time.Date(2024, time.September, date, 0, 0, 0, 0, time.UTC),
+		}
+	}
+	results := []scraper.ScrapeResult{{Week: week, Status: scraper.ScrapeOK, Lessons: []scraper.Lesson{
+		lesson("Thursday", 26, "Python L2", "16:00", "17:00"),
+		lesson("Saturday", 28, "Scratch L1", "10:00", "11:00"),
+	}}}
+	if _, err := dataStore.RecordScrape("alice", results); err != nil {
+		t.Fatal(err)
+	}
+
+	// The dashboard gives the user a feed token the first time
+	if rec := serve(DashboardHandler, httptest.NewRequest(http.MethodGet, "/dashboard", nil), cookie); rec.Code != http.StatusOK {
+		t.Fatalf("dashboard status = %d, want 200", rec.Code)
+	}
+	userCfg, _ := lookupUser("alice")
+	token := userCfg.FeedToken
+	if token == "" {
+		t.Fatalf("no feed token created")
+	}
+
+	rec := getFeed(token)
+	if rec.Code != http.StatusOK || !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/calendar") {
+		t.Fatalf("feed: status %d, type %q, want a calendar", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	cal, err := ics.ParseCalendar(rec.Body)
+	if err != nil {
+		t.Fatalf("feed does not parse: %v", err)
+	}
+
+	var got []string
+	for _, event := range cal.Events() {
+		start := event.GetProperty(ics.ComponentPropertyDtStart)
+		if tzid := start.ICalParameters[string(ics.ParameterTzid)]; len(tzid) != 1 || tzid[0] != "Europe/London" {
+			t.Errorf("event %s starts in time zone %v, want Europe/London", event.Id(), tzid)
+		}
+		got = append(got, event.GetProperty(ics.ComponentPropertySummary).Value+" "+start.Value)
+	}
+	sort.Strings(got)
+	want := []string{"Python L2 20240926T160000", "Scratch L1 20240928T100000"}
+	if strings.Join(got, ", ") != strings.Join(want, ", ") {
+		t.Errorf("feed events = %q, want %q", got, want)
+	}
+
+	// A new token replaces the old one, whose URL stops working
+	rec = postForm(RotateFeedTokenHandler, "/rotate_feed_token", cookie, url.Values{csrfField: {csrfToken}})
+	if rec.Code != http.StatusSeeOther {
+		t.Fatalf("rotate status = %d, want 303", rec.Code)
+	}
+	userCfg, _ = lookupUser("alice")
+	if userCfg.FeedToken == "" || userCfg.FeedToken == token {
+		t.Fatalf("feed token %q not rotated", userCfg.FeedToken)
+	}
+	if rec := getFeed(token); rec.Code != http.StatusNotFound {
+		t.Errorf("old feed URL: status %d, want 404", rec.Code)
+	}
+	if rec := getFeed(userCfg.FeedToken); rec.Code != http.StatusOK {
+		t.Errorf("new feed URL: status %d, want 200", rec.Code)
+	}
+	for _, guess := range []string{"", "feed"} {
+		if rec := getFeed(guess); rec.Code != http.StatusNotFound {
+			t.Errorf("feed token %q: status %d, want 404", guess, rec.Code)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package site
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"funtech-scraper/config"
+	"funtech-scraper/scraper"
+
+	"golang.org/x/oauth2"
+)
+
+// oauthStateTTL is how long the user has to authorise the site with Google.
+const oauthStateTTL = 10 * time.Minute
+
+// redirectToGoogleAuth sends the user to Google to authorise access to their calendars. The state
+// sent along is random and tied to the browser session, so a callback cannot be forged or replayed,
+// and the code can only be exchanged with the PKCE verifier kept on the server.
+func redirectToGoogleAuth(w http.ResponseWriter, r *http.Request, sessionID, username string) {
+	verifier := oauth2.GenerateVerifier()
+	state, err := dataStore.CreateOAuthState(sessionID, username, verifier, oauthStateTTL)
+	if err != nil {
+		log.Printf("Error starting Google authorization for user (%s): %v\n", username, err)
+		http.Error(w, "Error starting Google authorization", http.StatusInternalServerError)
+		return
+	}
+
+	authURL := oauthConfig.AuthCodeURL(state, oauth2.AccessTypeOffline, oauth2.ApprovalForce, oauth2.S256ChallengeOption(verifier))
+	log.Printf("User %s needs Google Auth, redirecting to Google", username)
+	http.Redirect(w, r, authURL, http.StatusSeeOther)
+}
+
+// GoogleAuthHandler sends the user to Google to authorise the site again, after the daemon found
+// their saved token no longer works.
+func GoogleAuthHandler(w http.ResponseWriter, r *http.Request) {
+	log.Printf("Received request on /google_auth from %s", r.RemoteAddr)
+	username, _, _, ok := requirePost(w, r)
+	if !ok {
+		return
+	}
+	redirectToGoogleAuth(w, r, sessionID(r), username)
+}
+
+// AuthCallbackHandler completes a Google authorisation started by redirectToGoogleAuth: it checks the
+// state belongs to this browser session, exchanges the code for a token and saves it.
+func AuthCallbackHandler(w http.ResponseWriter, r *http.Request) {
+	log.Printf("Received request on /auth_callback from %s", r.RemoteAddr)
+	username, _, _, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
+	redirect := func(message string) {
+		http.Redirect(w, r, "/dashboard?message="+url.QueryEscape(message), http.StatusSeeOther)
+	}
+
+	query := r.URL.Query()
+	stateUser, verifier, ok, err := dataStore.ConsumeOAuthState(query.Get("state"), sessionID(r))
+	if err != nil {
+		log.Printf("Error checking OAuth state for user (%s): %v\n", username, err)
+		http.Error(w, "Error completing Google authorization", http.StatusInternalServerError)
+		return
+	}
+	if !ok || stateUser != username {
+		log.Printf("Rejected Google authorization callback with an invalid state for user: %s", username)
+		redirect("Authorization failed: the request had expired or did not come from this browser. Please try again.")
+		return
+	}
+	if errCode := query.Get("error"); errCode != "" {
+		log.Printf("Google authorization declined for user (%s): %s", username, errCode)
+		redirect("Authorization was not granted. Please try again.")
+		return
+	}
+
+	token, err := oauthConfig.Exchange(context.Background(), query.Get("code"), oauth2.VerifierOption(verifier))
+	if err != nil {
+		log.Printf("Authorization failed for user: %s, error: %v", username, err)
+		redirect("Authorization failed. Please try again.")
+		return
+	}
+	// Only the token is written, so changes the daemon made to the config are kept
+	_, err = updateUser(username, func(stored *config.UserConfig) error {
+		scraper.SetUserToken(stored, token)
+		stored.NeedsReauth = false
+		return nil
+	})
+	if err != nil {
+		log.Printf("Error saving Google token for user (%s): %v\n", username, err)
+		http.Error(w, "Error saving Google authorization", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Authorization completed for user: %s", username)
+	redirect("Authorization completed. You can close this window.")
+}
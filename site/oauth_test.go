@@ -0,0 +1,119 @@
+package site
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"funtech-scraper/config"
+)
+
+// startTokenServer stands in for Google's token endpoint, granting a token for every code.
+func startTokenServer(t *testing.T) *int {
+	t.Helper()
+	exchanges := new(int)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*exchanges++
+		if r.FormValue("code_verifier") == "" {
+			http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"access_token":"access-%d","refresh_token":"refresh","token_type":"Bearer","expires_in":3600}`, *exchanges)
+	}))
+	t.Cleanup(srv.Close)
+	oauthConfig.Endpoint.TokenURL = srv.URL
+	return exchanges
+}
+
+// startGoogleAuth starts an authorisation from the session and returns the state sent to Google.
+func startGoogleAuth(t *testing.T, cookie *http.Cookie, csrfToken string) string {
+	t.Helper()
+	rec := postForm(GoogleAuthHandler, "/google_auth", cookie, url.Values{csrfField: {csrfToken}})
+	if rec.Code != http.StatusSeeOther {
+		t.Fatalf("google_auth status = %d, want a redirect to Google", rec.Code)
+	}
+	location, err := url.Parse(rec.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if location.Query().Get("code_challenge") == "" {
+		t.Errorf("authorization URL %s has no PKCE challenge", location)
+	}
+	return location.Query().Get("state")
+}
+
+// callback sends Google's redirect back to the site from the session and returns the message shown.
+func callback(t *testing.T, cookie *http.Cookie, state string) string {
+	t.Helper()
+	r := httptest.NewRequest(http.MethodGet, "/auth_callback?code=code&state="+url.QueryEscape(state), nil)
+	rec := serve(AuthCallbackHandler, r, cookie)
+	location, err := url.Parse(rec.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return location.Query().Get("message")
+}
+
+func TestAuthCallbackStateIsSingleUse(t *testing.T) {
+	setupSite(t)
+	exchanges := startTokenServer(t)
+	addTestUser(t, "alice", &config.UserConfig{Username: "alice", CalendarSink: "google"})
+	cookie, csrfToken := startTestSession(t, "alice")
+
+	state := startGoogleAuth(t, cookie, csrfToken)
+	if message := callback(t, cookie, state); !strings.HasPrefix(message, "Authorization completed") {
+		t.Fatalf("first callback: %q, want the authorization completed", message)
+	}
+	if userCfg, _ := lookupUser("alice"); userCfg.AccessToken != "access-1" {
+		t.Errorf("saved access token %q, want access-1", userCfg.AccessToken)
+	}
+
+	if message := callback(t, cookie, state); !strings.HasPrefix(message, "Authorization failed") {
+		t.Errorf("replayed callback: %q, want it rejected", message)
+	}
+	if *exchanges != 1 {
+		t.Errorf("%d codes exchanged, want only the first callback's", *exchanges)
+	}
+	if userCfg, _ := lookupUser("alice"); userCfg.AccessToken != "access-1" {
+		t.Errorf("replayed callback replaced the token with %q", userCfg.AccessToken)
+	}
+}
+
+func TestAuthCallbackStateIsBoundToSession(t *testing.T) {
+	setupSite(t)
+	exchanges := startTokenServer(t)
+	addTestUser(t, "alice", &config.UserConfig{Username: "alice", CalendarSink: "google"})
+	addTestUser(t, "mallory", &config.UserConfig{Username: "mallory", CalendarSink: "google"})
+
+	tests := []struct {
+		name  string
+		other string // User of the session the callback comes from
+	}{
+		{name: "another session of the same user", other: "alice"},
+		{name: "another user's session", other: "mallory"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cookie, csrfToken := startTestSession(t, "alice")
+			state := startGoogleAuth(t, cookie, csrfToken)
+
+			otherCookie, _ := startTestSession(t, tt.other)
+			if message := callback(t, otherCookie, state); !strings.HasPrefix(message, "Authorization failed") {
+				t.Errorf("callback from another session: %q, want it rejected", message)
+			}
+			if *exchanges != 0 {
+				t.Errorf("%d codes exchanged, want none", *exchanges)
+			}
+			for _, username := range []string{"alice", "mallory"} {
+				if userCfg, _ := lookupUser(username); userCfg.AccessToken != "" {
+					t.Errorf("%s was given token %q", username, userCfg.AccessToken)
+				}
+			}
+		})
+	}
+}
@@ -1,26 +1,46 @@
 package site
 
 import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"html/template"
 	"log"
 	"net/http"
 	"net/url"
 	"path/filepath"
-	"text/template"
+	"strings"
+	"sync"
+	"time"
 
 	"funtech-scraper/config"
 	"funtech-scraper/scraper"
+	"funtech-scraper/store"
 
 	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/google"
 	"google.golang.org/api/calendar/v3"
 )
 
+// recentChangesShown is how many lesson changes the dashboard lists.
+const recentChangesShown = 10
+
+// previewInterval is how long a user must wait between previews, as each one scrapes the portal.
+const previewInterval = time.Minute
+
+// lastPreview holds when each user last previewed their changes.
+var (
+	previewsMu  sync.Mutex
+	lastPreview = make(map[string]time.Time)
+)
+
 var (
-	templates   = template.Must(template.ParseGlob("site/templates/*.html"))
-	users       = make(map[string]*config.UserConfig)
+	templates   *template.Template
 	oauthConfig *oauth2.Config
 	commonCfg   *config.CommonConfig
+	dataStore   *store.Store
+	userStore   config.UserStore
 )
 
 func InitOAuthConfig(cfg *config.CommonConfig) {
@@ -34,41 +54,32 @@ func InitOAuthConfig(cfg *config.CommonConfig) {
 	}
 }
 
-func LoadUserConfigs() error {
-	userConfigFiles, err := filepath.Glob("config/user_configs/*.json")
+// InitTemplates loads the page templates from dir. They escape everything they are given, such as
+// messages in the URL and course names scraped from the portal.
+func InitTemplates(dir string) error {
+	parsed, err := template.ParseGlob(filepath.Join(dir, "*.html"))
 	if err != nil {
-		return err
+		return fmt.Errorf("error loading templates from %s: %v", dir, err)
 	}
-
-	for _, userConfigFile := range userConfigFiles {
-		userCfg, err := config.LoadUserConfig(userConfigFile)
-		if err != nil {
-			return fmt.Errorf("error loading user config (%s): %v", userConfigFile, err)
-		}
-		users[userCfg.Username] = userCfg
-	}
-
+	templates = parsed
 	return nil
 }
 
+// InitStore sets the store the site reads scraped lessons and login sessions from.
+func InitStore(s *store.Store) {
+	dataStore = s
+}
+
 func AuthHandler(w http.ResponseWriter, r *http.Request) {
 	log.Printf("Received request on /auth from %s", r.RemoteAddr)
-	username, err := r.Cookie("username")
-	if err == nil && username != nil {
-		if _, ok := users[username.Value]; ok {
-			log.Printf("Redirecting to /dashboard for user: %s", username.Value)
-			http.Redirect(w, r, "/dashboard", http.StatusSeeOther)
-			return
-		} else {
-			// Invalid cookie, delete it
-			http.SetCookie(w, &http.Cookie{
-				Name:   "username",
-				Value:  "",
-				Path:   "/",
-				MaxAge: -1,
-			})
-			log.Printf("Invalid cookie found for user: %s, deleting cookie", username.Value)
-		}
+	if _, _, _, ok := sessionUser(r); ok {
+		log.Printf("Redirecting logged-in user to /dashboard")
+		http.Redirect(w, r, "/dashboard", http.StatusSeeOther)
+		return
+	}
+	// Browsers may still have the username cookie from before sessions; it is no longer trusted
+	if _, err := r.Cookie("username"); err == nil {
+		http.SetCookie(w, &http.Cookie{Name: "username", Value: "", Path: "/", MaxAge: -1})
 	}
 
 	if r.Method == http.MethodPost {
@@ -77,21 +88,45 @@ func AuthHandler(w http.ResponseWriter, r *http.Request) {
 		password := r.FormValue("password")
 
 		if action == "login" {
-			userCfg, ok := users[username]
-			if !ok || userCfg.Password != password {
+			userCfg, ok := lookupUser(username)
+			if !ok {
 				log.Printf("Invalid login attempt for user: %s", username)
 				http.Error(w, "Invalid credentials", http.StatusUnauthorized)
 				return
 			}
+			passwordOK, migrated := checkWebPassword(userCfg, password)
+			if !passwordOK {
+				log.Printf("Invalid login attempt for user: %s", username)
+				http.Error(w, "Invalid credentials", http.StatusUnauthorized)
+				return
+			}
+			if migrated {
+				log.Printf("Created web password from FunTech password for user: %s", username)
+				_, err := updateUser(username, func(stored *config.UserConfig) error {
+					stored.WebPasswordHash = userCfg.WebPasswordHash
+					return nil
+				})
+				if err != nil {
+					log.Printf("Error saving web password for user (%s): %v\n", username, err)
+				}
+			}
+
+			log.Printf("Successful login for user: %s", username)
+			sessionID, err := startSession(w, r, username)
+			if err != nil {
+				log.Printf("Error starting session for user (%s): %v\n", username, err)
+				http.Error(w, "Error logging in", http.StatusInternalServerError)
+				return
+			}
 
-			// Attempt to get Google Calendar service
-			_, err := scraper.GetCalendarService(commonCfg, userCfg, config.GetAuthCode, config.SaveUserConfig)
+			// Attempt to get Google Calendar service, unless the user syncs into another calendar
+			if usesGoogleCalendar(userCfg) {
+				_, err = scraper.GetCalendarService(commonCfg, userStore, username, userCfg)
+			}
 			if err != nil {
 				// Redirect to Google OAuth2 if authentication is needed
-				authURL, needsAuth := scraper.NeedsGoogleAuth(userCfg, commonCfg)
-				if needsAuth {
-					log.Printf("User needs Google Auth, redirecting to: %s", authURL)
-					http.Redirect(w, r, authURL, http.StatusSeeOther)
+				if isGoogleAuthError(err) || scraper.NeedsGoogleAuth(userCfg) {
+					redirectToGoogleAuth(w, r, sessionID, username)
 					return
 				}
 
@@ -100,39 +135,50 @@ func AuthHandler(w http.ResponseWriter, r *http.Request) {
 				return
 			}
 
-			log.Printf("Successful login for user: %s", username)
-			http.SetCookie(w, &http.Cookie{
-				Name:  "username",
-				Value: username,
-				Path:  "/",
-			})
-
+			// Users who logged in with their FunTech password should pick a separate one for the site
+			if migrated {
+				message := "You logged in with your FunTech password. Please choose a separate password for this site below."
+				http.Redirect(w, r, "/dashboard?message="+url.QueryEscape(message), http.StatusSeeOther)
+				return
+			}
 			http.Redirect(w, r, "/dashboard", http.StatusSeeOther)
 		} else if action == "register" {
-			if _, exists := users[username]; exists {
-				log.Printf("Attempt to register existing user: %s", username)
-				http.Error(w, "User already exists", http.StatusBadRequest)
+			if err := config.ValidateUsername(username); err != nil {
+				log.Printf("Rejected username for new user %q: %v", username, err)
+				http.Error(w, "Invalid username", http.StatusBadRequest)
 				return
 			}
-
 			userCfg := &config.UserConfig{
 				Username: username,
-				Password: password,
+				Password: r.FormValue("funtech_password"),
+			}
+			if err := setWebPassword(userCfg, password); err != nil {
+				log.Printf("Rejected web password for new user %s: %v", username, err)
+				http.Error(w, fmt.Sprintf("Invalid password: %v", err), http.StatusBadRequest)
+				return
+			}
+			added, err := addUser(username, userCfg)
+			if err != nil {
+				log.Printf("Error saving new user (%s): %v\n", username, err)
+				http.Error(w, "Error registering", http.StatusInternalServerError)
+				return
+			}
+			if !added {
+				log.Printf("Attempt to register existing user: %s", username)
+				http.Error(w, "User already exists", http.StatusBadRequest)
+				return
 			}
-			users[username] = userCfg
-			config.SaveUserConfig(username, userCfg)
 
 			log.Printf("New user registered: %s", username)
-			http.SetCookie(w, &http.Cookie{
-				Name:  "username",
-				Value: username,
-				Path:  "/",
-			})
+			sessionID, err := startSession(w, r, username)
+			if err != nil {
+				log.Printf("Error starting session for user (%s): %v\n", username, err)
+				http.Error(w, "Error logging in", http.StatusInternalServerError)
+				return
+			}
 
 			// Redirect to Google OAuth2 for authorization
-			authURL, _ := scraper.NeedsGoogleAuth(userCfg, commonCfg)
-			log.Printf("Redirecting new user %s to Google OAuth2: %s", username, authURL)
-			http.Redirect(w, r, authURL, http.StatusSeeOther)
+			redirectToGoogleAuth(w, r, sessionID, username)
 		}
 		return
 	}
@@ -142,17 +188,8 @@ func AuthHandler(w http.ResponseWriter, r *http.Request) {
 
 func DashboardHandler(w http.ResponseWriter, r *http.Request) {
 	log.Printf("Received request on /dashboard from %s", r.RemoteAddr)
-	username, err := r.Cookie("username")
-	if err != nil {
-		log.Printf("No username cookie found, redirecting to /auth")
-		http.Redirect(w, r, "/auth", http.StatusSeeOther)
-		return
-	}
-
-	userCfg, ok := users[username.Value]
+	username, userCfg, csrfToken, ok := requireUser(w, r)
 	if !ok {
-		log.Printf("User not found in configs: %s, redirecting to /auth", username.Value)
-		http.Redirect(w, r, "/auth", http.StatusSeeOther)
 		return
 	}
 
@@ -160,42 +197,104 @@ func DashboardHandler(w http.ResponseWriter, r *http.Request) {
 	data := struct {
 		Message          string
 		Username         string
+		CSRFToken        string
 		GoogleCalendarID string
-		Password         string
 		Calendars        []*calendar.CalendarListEntry
+		LastRun          *store.SyncRun
+		ApproveNextSync  bool
+		CalendarSink     string // Empty when syncing into Google Calendar
+		FeedURL          string
+		LastScraped      time.Time
+		RecentChanges    []scraper.LessonChange
+		NeedsReauth      bool // Google rejected the saved token, so the user must reconnect
 	}{
 		Message:          message,
 		Username:         userCfg.Username,
+		CSRFToken:        csrfToken,
 		GoogleCalendarID: userCfg.GoogleCalendarID,
-		Password:         userCfg.Password,
+		ApproveNextSync:  userCfg.ApproveNextSync,
+		NeedsReauth:      userCfg.NeedsReauth,
+	}
+	if !usesGoogleCalendar(userCfg) {
+		data.CalendarSink = userCfg.CalendarSink
+	}
+	if userCfg.FeedToken == "" {
+		if err := rotateFeedToken(username, userCfg); err != nil {
+			log.Printf("Error creating feed token for user (%s): %v\n", userCfg.Username, err)
+		}
+	}
+	if userCfg.FeedToken != "" {
+		data.FeedURL = feedURL(r, userCfg.FeedToken)
+	}
+	if lastRun, err := dataStore.LastSyncRun(username); err != nil {
+		log.Printf("Error reading last sync run for user (%s): %v\n", userCfg.Username, err)
+	} else {
+		data.LastRun = lastRun
+	}
+	if lastScraped, err := dataStore.LastScraped(username); err != nil {
+		log.Printf("Error reading last scrape for user (%s): %v\n", userCfg.Username, err)
+	} else {
+		data.LastScraped = lastScraped
+	}
+	if changes, err := dataStore.LessonChanges(username, recentChangesShown); err != nil {
+		log.Printf("Error reading lesson changes for user (%s): %v\n", userCfg.Username, err)
+	} else {
+		data.RecentChanges = changes
 	}
 
 	if r.Method == http.MethodPost {
-		userCfg.GoogleCalendarID = r.FormValue("google_calendar_id")
-		userCfg.Username = r.FormValue("username")
-		userCfg.Password = r.FormValue("password")
-		config.SaveUserConfig(username.Value, userCfg)
+		if !validCSRFToken(r, csrfToken) {
+			log.Printf("Rejected form without a valid CSRF token for user: %s", username)
+			http.Error(w, "Invalid form, please reload the page and try again", http.StatusForbidden)
+			return
+		}
+		userCfg, err := updateUser(username, func(stored *config.UserConfig) error {
+			if usesGoogleCalendar(stored) {
+				stored.GoogleCalendarID = r.FormValue("google_calendar_id")
+			}
+			stored.Username = r.FormValue("username")
+			// The FunTech password is never sent back to the browser, so an empty field keeps it
+			if password := r.FormValue("password"); password != "" {
+				stored.Password = password
+			}
+			return nil
+		})
+		if err != nil {
+			log.Printf("Error saving user config for user (%s): %v\n", username, err)
+			http.Error(w, "Error saving config", http.StatusInternalServerError)
+			return
+		}
 
-		log.Printf("User config saved for user: %s", username.Value)
+		log.Printf("User config saved for user: %s", username)
 		// Check if Google Auth is needed and redirect if so
-		if authURL, needsAuth := scraper.NeedsGoogleAuth(userCfg, commonCfg); needsAuth {
-			log.Printf("User needs Google Auth, redirecting to: %s", authURL)
-			http.Redirect(w, r, authURL, http.StatusSeeOther)
+		if usesGoogleCalendar(userCfg) && scraper.NeedsGoogleAuth(userCfg) {
+			redirectToGoogleAuth(w, r, sessionID(r), username)
 			return
 		}
 
-		message = "Config saved successfully for user: " + username.Value
+		message = "Config saved successfully for user: " + username
 		http.Redirect(w, r, "/dashboard?message="+url.QueryEscape(message), http.StatusSeeOther)
 		return
 	}
 
+	// Calendars cannot be listed until the user reconnects Google Calendar
+	if !usesGoogleCalendar(userCfg) || data.NeedsReauth {
+		templates.ExecuteTemplate(w, "dashboard.html", data)
+		return
+	}
+
 	// Retrieve the list of calendars
-	service, err := scraper.GetCalendarService(commonCfg, userCfg, config.GetAuthCode, config.SaveUserConfig)
+	service, err := scraper.GetCalendarService(commonCfg, userStore, username, userCfg)
+	if isGoogleAuthError(err) {
+		log.Printf("Google authorization needed for user (%s): %v\n", userCfg.Username, err)
+		data.NeedsReauth = true
+		templates.ExecuteTemplate(w, "dashboard.html", data)
+		return
+	}
 	if err != nil {
 		log.Printf("Error getting Google Calendar service for user (%s): %v\n", userCfg.Username, err)
-		if authURL, needsAuth := scraper.NeedsGoogleAuth(userCfg, commonCfg); needsAuth {
-			log.Printf("User needs Google Auth, redirecting to: %s", authURL)
-			http.Redirect(w, r, authURL, http.StatusSeeOther)
+		if scraper.NeedsGoogleAuth(userCfg) {
+			redirectToGoogleAuth(w, r, sessionID(r), username)
 			return
 		}
 		http.Error(w, fmt.Sprintf("Error getting Google Calendar service for user: %s", userCfg.Username), http.StatusInternalServerError)
@@ -204,9 +303,8 @@ func DashboardHandler(w http.ResponseWriter, r *http.Request) {
 	calendars, err := scraper.GetUserCalendars(service)
 	if err != nil {
 
-		if authURL, needsAuth := scraper.NeedsGoogleAuth(userCfg, commonCfg); needsAuth {
-			log.Printf("User needs Google Auth, redirecting to: %s", authURL)
-			http.Redirect(w, r, authURL, http.StatusSeeOther)
+		if scraper.NeedsGoogleAuth(userCfg) {
+			redirectToGoogleAuth(w, r, sessionID(r), username)
 			return
 		}
 		log.Printf("Error retrieving calendars for user (%s): %v\n", userCfg.Username, err)
@@ -218,27 +316,223 @@ func DashboardHandler(w http.ResponseWriter, r *http.Request) {
 	templates.ExecuteTemplate(w, "dashboard.html", data)
 }
 
-func AuthCallbackHandler(w http.ResponseWriter, r *http.Request) {
-	log.Printf("Received request on /auth_callback from %s", r.RemoteAddr)
-	state := r.URL.Query().Get("state")
-	code := r.URL.Query().Get("code")
+// ApproveSyncHandler lets the user's next sync through the mass-deletion guard once.
+func ApproveSyncHandler(w http.ResponseWriter, r *http.Request) {
+	log.Printf("Received request on /approve_sync from %s", r.RemoteAddr)
+	username, userCfg, _, ok := requirePost(w, r)
+	if !ok {
+		return
+	}
+
+	_, err := updateUser(username, func(stored *config.UserConfig) error {
+		stored.ApproveNextSync = true
+		return nil
+	})
+	if err != nil {
+		log.Printf("Error saving sync approval for user (%s): %v\n", userCfg.Username, err)
+		http.Error(w, "Error saving approval", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Next sync approved for user: %s", userCfg.Username)
+	message := "The next sync will go ahead even if it removes many events."
+	http.Redirect(w, r, "/dashboard?message="+url.QueryEscape(message), http.StatusSeeOther)
+}
+
+// AdoptEventsHandler lets the user's next sync take over the events in their calendar that match a
+// lesson but were not created by the sync, such as events synced before lessons were tagged.
+func AdoptEventsHandler(w http.ResponseWriter, r *http.Request) {
+	log.Printf("Received request on /adopt_events from %s", r.RemoteAddr)
+	username, userCfg, _, ok := requirePost(w, r)
+	if !ok {
+		return
+	}
+
+	_, err := updateUser(username, func(stored *config.UserConfig) error {
+		stored.AdoptUntagged = true
+		return nil
+	})
+	if err != nil {
+		log.Printf("Error saving event adoption for user (%s): %v\n", userCfg.Username, err)
+		http.Error(w, "Error saving adoption", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Event adoption approved for user: %s", userCfg.Username)
+	message := "The next sync will take over the events that match your lessons."
+	http.Redirect(w, r, "/dashboard?message="+url.QueryEscape(message), http.StatusSeeOther)
+}
+
+// FeedHandler serves a user's lessons as an iCalendar feed. The token in the URL is the only
+// credential, so calendar apps can subscribe without logging in.
+func FeedHandler(w http.ResponseWriter, r *http.Request) {
+	log.Printf("Received request on /feed from %s", r.RemoteAddr)
+	token := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/feed/"), ".ics")
+
+	username, userCfg, ok := userByFeedToken(token)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	lessons, err := dataStore.Lessons(username)
+	if err != nil {
+		log.Printf("Error loading lessons for feed of user (%s): %v\n", userCfg.Username, err)
+		http.Error(w, "Error loading lessons", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("Content-Disposition", `inline; filename="funtech-lessons.ics"`)
+	fmt.Fprint(w, scraper.BuildLessonFeed(lessons))
+}
+
+// RotateFeedTokenHandler replaces the user's feed token, so the old feed URL stops working.
+func RotateFeedTokenHandler(w http.ResponseWriter, r *http.Request) {
+	log.Printf("Received request on /rotate_feed_token from %s", r.RemoteAddr)
+	username, userCfg, _, ok := requirePost(w, r)
+	if !ok {
+		return
+	}
+
+	if err := rotateFeedToken(username, userCfg); err != nil {
+		log.Printf("Error rotating feed token for user (%s): %v\n", userCfg.Username, err)
+		http.Error(w, "Error creating a new feed address", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Feed token rotated for user: %s", userCfg.Username)
+	message := "Your feed has a new address. Update your calendar subscriptions to keep receiving lessons."
+	http.Redirect(w, r, "/dashboard?message="+url.QueryEscape(message), http.StatusSeeOther)
+}
+
+// rotateFeedToken gives the user a new random feed token and saves it.
+func rotateFeedToken(username string, userCfg *config.UserConfig) error {
+	token := make([]byte, 32)
+	if _, err := rand.Read(token); err != nil {
+		return err
+	}
+	userCfg.FeedToken = hex.EncodeToString(token)
+	_, err := updateUser(username, func(stored *config.UserConfig) error {
+		stored.FeedToken = userCfg.FeedToken
+		return nil
+	})
+	return err
+}
+
+// feedURL builds the absolute URL of a feed as seen by the client, for pasting into calendar apps.
+func feedURL(r *http.Request, token string) string {
+	scheme := "http"
+	if isHTTPS(r) {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host + "/feed/" + token + ".ics"
+}
+
+// isGoogleAuthError reports whether err, or an error it wraps, is a *scraper.GoogleAuthError, meaning
+// the user must connect Google Calendar again.
+func isGoogleAuthError(err error) bool {
+	var authErr *scraper.GoogleAuthError
+	return errors.As(err, &authErr)
+}
+
+// usesGoogleCalendar reports whether the user syncs into Google Calendar rather than another calendar sink.
+func usesGoogleCalendar(userCfg *config.UserConfig) bool {
+	return userCfg.CalendarSink == "" || userCfg.CalendarSink == "google"
+}
 
-	config.SetAuthCode(state, code)
+// PreviewHandler scrapes the user's lessons and shows the changes a sync would make to their calendar
+// without making them. It only answers POST requests, at most once per previewInterval for each user,
+// so the portal is not scraped by links, prefetching or reloads.
+func PreviewHandler(w http.ResponseWriter, r *http.Request) {
+	log.Printf("Received request on /preview from %s", r.RemoteAddr)
+	username, userCfg, csrfToken, ok := requirePost(w, r)
+	if !ok {
+		return
+	}
+	if userCfg.CalendarSink == config.CalendarSinkFeed {
+		http.Redirect(w, r, "/dashboard?message="+url.QueryEscape("Your lessons are only published in your feed, so there is no calendar to preview."), http.StatusSeeOther)
+		return
+	}
+	if usesGoogleCalendar(userCfg) && userCfg.GoogleCalendarID == "" {
+		http.Redirect(w, r, "/dashboard?message="+url.QueryEscape("Select a calendar before previewing changes."), http.StatusSeeOther)
+		return
+	}
 
-	userCfg, exists := users[state]
-	if exists {
-		_, err := scraper.GetCalendarService(commonCfg, userCfg, config.GetAuthCode, config.SaveUserConfig)
-		if err == nil {
-			log.Printf("Authorization completed for user: %s", state)
-			http.Redirect(w, r, "/dashboard?message=Authorization completed. You can close this window.", http.StatusSeeOther)
-		} else {
-			log.Printf("Authorization failed for user: %s, error: %v", state, err)
-			http.Redirect(w, r, "/dashboard?message=Authorization failed. Please try again.", http.StatusSeeOther)
+	sink, err := scraper.NewCalendarSink(commonCfg, userStore, username, userCfg, nil)
+	if err != nil {
+		log.Printf("Error setting up calendar for user (%s): %v\n", userCfg.Username, err)
+		if !usesGoogleCalendar(userCfg) {
+			http.Error(w, fmt.Sprintf("Error setting up calendar for user: %s", userCfg.Username), http.StatusInternalServerError)
+			return
 		}
-	} else {
-		log.Printf("User not found for state: %s", state)
-		http.Error(w, "User not found", http.StatusBadRequest)
+		if isGoogleAuthError(err) || scraper.NeedsGoogleAuth(userCfg) {
+			redirectToGoogleAuth(w, r, sessionID(r), username)
+			return
+		}
+		http.Error(w, fmt.Sprintf("Error getting Google Calendar service for user: %s", userCfg.Username), http.StatusInternalServerError)
+		return
 	}
+
+	if !allowPreview(username) {
+		http.Redirect(w, r, "/dashboard?message="+url.QueryEscape("Please wait a minute before previewing changes again."), http.StatusSeeOther)
+		return
+	}
+
+	data := struct {
+		Username      string
+		CSRFToken     string
+		Error         string
+		Plan          *scraper.SyncPlan
+		AdoptUntagged bool
+	}{
+		Username:      userCfg.Username,
+		CSRFToken:     csrfToken,
+		AdoptUntagged: userCfg.AdoptUntagged,
+	}
+
+	results, err := scrapeUserLessons(userCfg)
+	if err != nil {
+		log.Printf("Error scraping lessons for preview for user (%s): %v\n", userCfg.Username, err)
+		data.Error = fmt.Sprintf("Could not fetch your lessons from FunTech: %v", err)
+		templates.ExecuteTemplate(w, "preview.html", data)
+		return
+	}
+
+	plan, err := scraper.PlanSync(sink, results, userCfg.AdoptUntagged)
+	if err != nil {
+		log.Printf("Error planning sync for user (%s): %v\n", userCfg.Username, err)
+		data.Error = fmt.Sprintf("Could not read your calendar: %v", err)
+		templates.ExecuteTemplate(w, "preview.html", data)
+		return
+	}
+	data.Plan = plan
+
+	templates.ExecuteTemplate(w, "preview.html", data)
+}
+
+// allowPreview reports whether the user may preview their changes now, and if so starts their wait
+// for the next preview.
+func allowPreview(username string) bool {
+	previewsMu.Lock()
+	defer previewsMu.Unlock()
+
+	if last, ok := lastPreview[username]; ok && time.Since(last) < previewInterval {
+		return false
+	}
+	lastPreview[username] = time.Now()
+	return true
+}
+
+// scrapeUserLessons scrapes all of a user's lessons with the configured portal backend.
+func scrapeUserLessons(userCfg *config.UserConfig) ([]scraper.ScrapeResult, error) {
+	client, closeClient, err := scraper.NewPortalClient(commonCfg)
+	if err != nil {
+		return nil, err
+	}
+	defer closeClient()
+
+	return scraper.ScrapeAllLessonsWithClient(client, userCfg.Username, userCfg.Password)
 }
 
 func HomeRedirectHandler(w http.ResponseWriter, r *http.Request) {
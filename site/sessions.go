@@ -0,0 +1,130 @@
+package site
+
+import (
+	"crypto/subtle"
+	"log"
+	"net/http"
+	"time"
+
+	"funtech-scraper/config"
+)
+
+const (
+	sessionCookie = "session"
+	sessionTTL    = 7 * 24 * time.Hour
+	csrfField     = "csrf_token" // Form field holding the session's CSRF token
+)
+
+// startSession logs the user in: it creates a server-side session, gives the browser its ID and
+// returns it.
+func startSession(w http.ResponseWriter, r *http.Request, username string) (string, error) {
+	id, err := dataStore.CreateSession(username, sessionTTL)
+	if err != nil {
+		return "", err
+	}
+	http.SetCookie(w, sessionCookieFor(r, id, int(sessionTTL.Seconds())))
+	return id, nil
+}
+
+// sessionID returns the session ID the browser sent, or an empty string if it sent none.
+func sessionID(r *http.Request) string {
+	cookie, err := r.Cookie(sessionCookie)
+	if err != nil {
+		return ""
+	}
+	return cookie.Value
+}
+
+// endSession logs the user out, deleting the session so its ID cannot be used again.
+func endSession(w http.ResponseWriter, r *http.Request) {
+	if cookie, err := r.Cookie(sessionCookie); err == nil {
+		if err := dataStore.DeleteSession(cookie.Value); err != nil {
+			log.Printf("Error deleting session: %v", err)
+		}
+	}
+	http.SetCookie(w, sessionCookieFor(r, "", -1))
+}
+
+// sessionCookieFor builds the session cookie. It is hidden from scripts, not sent with cross-site
+// form posts, and only sent over HTTPS when the site is served over it.
+func sessionCookieFor(r *http.Request, id string, maxAge int) *http.Cookie {
+	return &http.Cookie{
+		Name:     sessionCookie,
+		Value:    id,
+		Path:     "/",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   isHTTPS(r),
+		SameSite: http.SameSiteLaxMode,
+	}
+}
+
+// sessionUser returns a copy of the config of the logged-in user, the name it is stored under and
+// the session's CSRF token, or reports false if the request has no valid session.
+func sessionUser(r *http.Request) (string, *config.UserConfig, string, bool) {
+	id := sessionID(r)
+	if id == "" {
+		return "", nil, "", false
+	}
+	username, csrfToken, ok, err := dataStore.SessionUser(id)
+	if err != nil {
+		log.Printf("Error reading session: %v", err)
+		return "", nil, "", false
+	}
+	if !ok {
+		return "", nil, "", false
+	}
+	userCfg, ok := lookupUser(username)
+	return username, userCfg, csrfToken, ok
+}
+
+// requireUser returns the logged-in user and their CSRF token, or redirects to /auth and reports false.
+func requireUser(w http.ResponseWriter, r *http.Request) (string, *config.UserConfig, string, bool) {
+	username, userCfg, csrfToken, ok := sessionUser(r)
+	if !ok {
+		log.Printf("No valid session, redirecting to /auth")
+		http.Redirect(w, r, "/auth", http.StatusSeeOther)
+	}
+	return username, userCfg, csrfToken, ok
+}
+
+// requirePost returns the logged-in user for a form posted from one of the site's pages. It refuses
+// other methods, and forms without the session's CSRF token, which other sites cannot read.
+func requirePost(w http.ResponseWriter, r *http.Request) (string, *config.UserConfig, string, bool) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return "", nil, "", false
+	}
+	username, userCfg, csrfToken, ok := requireUser(w, r)
+	if !ok {
+		return "", nil, "", false
+	}
+	if !validCSRFToken(r, csrfToken) {
+		log.Printf("Rejected form without a valid CSRF token for user: %s", username)
+		http.Error(w, "Invalid form, please reload the page and try again", http.StatusForbidden)
+		return "", nil, "", false
+	}
+	return username, userCfg, csrfToken, true
+}
+
+// validCSRFToken reports whether the posted form holds the session's CSRF token.
+func validCSRFToken(r *http.Request, csrfToken string) bool {
+	posted := r.PostFormValue(csrfField)
+	return csrfToken != "" && subtle.ConstantTimeCompare([]byte(posted), []byte(csrfToken)) == 1
+}
+
+// LogoutHandler ends the user's session.
+func LogoutHandler(w http.ResponseWriter, r *http.Request) {
+	log.Printf("Received request on /logout from %s", r.RemoteAddr)
+	if _, _, _, ok := requirePost(w, r); !ok {
+		return
+	}
+
+	endSession(w, r)
+	http.Redirect(w, r, "/auth", http.StatusSeeOther)
+}
+
+// isHTTPS reports whether the client reached the site over HTTPS, directly or through a proxy.
+func isHTTPS(r *http.Request) bool {
+	return r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https"
+}
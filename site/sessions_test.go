@@ -0,0 +1,109 @@
+package site
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"funtech-scraper/config"
+)
+
+// sessionCookieFrom returns the session cookie the response set, or fails the test.
+func sessionCookieFrom(t *testing.T, rec *httptest.ResponseRecorder) *http.Cookie {
+	t.Helper()
+	for _, cookie := range rec.Result().Cookies() {
+		if cookie.Name == sessionCookie && cookie.Value != "" {
+			return cookie
+		}
+	}
+	t.Fatalf("no session cookie set, status %d", rec.Code)
+	return nil
+}
+
+// loggedIn reports whether the dashboard lets the cookie in rather than redirecting to /auth.
+func loggedIn(cookie *http.Cookie) bool {
+	rec := serve(DashboardHandler, httptest.NewRequest(http.MethodGet, "/dashboard", nil), cookie)
+	return rec.Code == http.StatusOK
+}
+
+// logIn posts the login form and returns the response.
+func logIn(username, password string) *httptest.ResponseRecorder {
+	return postForm(AuthHandler, "/auth", nil, url.Values{"action": {"login"}, "username": {username}, "password": {password}})
+}
+
+func TestSessionsEnd(t *testing.T) {
+	tests := []struct {
+		name string
+		end  func(t *testing.T, cookie *http.Cookie)
+	}{
+		{
+			name: "expired",
+			end: func(t *testing.T, cookie *http.Cookie) {
+				// A session that was only valid for a moment has expired by the time it is used
+				id, err := dataStore.CreateSession("alice", time.Millisecond)
+				if err != nil {
+					t.Fatal(err)
+				}
+				time.Sleep(10 * time.Millisecond)
+				cookie.Value = id
+			},
+		},
+		{
+			name: "revoked",
+			end: func(t *testing.T, cookie *http.Cookie) {
+				if _, err := dataStore.DeleteUserSessions("alice"); err != nil {
+					t.Fatal(err)
+				}
+			},
+		},
+		{
+			name: "logged out",
+			end: func(t *testing.T, cookie *http.Cookie) {
+				_, csrfToken, _, err := dataStore.SessionUser(cookie.Value)
+				if err != nil {
+					t.Fatal(err)
+				}
+				rec := postForm(LogoutHandler, "/logout", cookie, url.Values{csrfField: {csrfToken}})
+				if rec.Code != http.StatusSeeOther {
+					t.Fatalf("logout status = %d, want 303", rec.Code)
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupSite(t)
+			userCfg := &config.UserConfig{Username: "alice"}
+			if err := setWebPassword(userCfg, "site password"); err != nil {
+				t.Fatal(err)
+			}
+			addTestUser(t, "alice", userCfg)
+
+			cookie := sessionCookieFrom(t, logIn("alice", "site password"))
+			if !loggedIn(cookie) {
+				t.Fatalf("new session is not logged in")
+			}
+
+			tt.end(t, cookie)
+			if loggedIn(cookie) {
+				t.Errorf("session is still logged in after it ended")
+			}
+		})
+	}
+}
+
+func TestSessionCookieIsTheOnlyCredential(t *testing.T) {
+	setupSite(t)
+	addTestUser(t, "alice", &config.UserConfig{Username: "alice"})
+
+	// The username cookie used before sessions is not trusted
+	if loggedIn(&http.Cookie{Name: "username", Value: "alice"}) {
+		t.Errorf("username cookie logs in")
+	}
+	if loggedIn(&http.Cookie{Name: sessionCookie, Value: "made-up"}) {
+		t.Errorf("unknown session ID logs in")
+	}
+}
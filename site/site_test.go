@@ -0,0 +1,138 @@
+package site
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"funtech-scraper/config"
+	"funtech-scraper/store"
+)
+
+// setupSite points the site at a new store and user directory, with no users.
+func setupSite(t *testing.T) {
+	t.Helper()
+	if err := InitTemplates("templates"); err != nil {
+		t.Fatal(err)
+	}
+	s, err := store.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	InitStore(s)
+	InitOAuthConfig(&config.CommonConfig{GoogleClientID: "client", GoogleClientSecret: "secret", GoogleRedirectURI: "http://localhost/auth_callback"})
+	if err := LoadUserConfigs(config.NewJSONDirStore(t.TempDir())); err != nil {
+		t.Fatal(err)
+	}
+
+	previewsMu.Lock()
+	lastPreview = make(map[string]time.Time)
+	previewsMu.Unlock()
+}
+
+// addTestUser saves a user who only uses the lesson feed, so no page calls Google.
+func addTestUser(t *testing.T, username string, userCfg *config.UserConfig) {
+	t.Helper()
+	if userCfg.CalendarSink == "" {
+		userCfg.CalendarSink = config.CalendarSinkFeed
+	}
+	if added, err := addUser(username, userCfg); err != nil || !added {
+		t.Fatalf("addUser(%s) = %v, %v", username, added, err)
+	}
+}
+
+// startTestSession logs the user in and returns the session cookie and the session's CSRF token.
+func startTestSession(t *testing.T, username string) (*http.Cookie, string) {
+	t.Helper()
+	id, err := dataStore.CreateSession(username, sessionTTL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, csrfToken, ok, err := dataStore.SessionUser(id)
+	if err != nil || !ok {
+		t.Fatalf("SessionUser = %v, %v", ok, err)
+	}
+	return &http.Cookie{Name: sessionCookie, Value: id}, csrfToken
+}
+
+// serve sends the request to the handler, with the cookie if there is one.
+func serve(handler http.HandlerFunc, r *http.Request, cookie *http.Cookie) *httptest.ResponseRecorder {
+	if cookie != nil {
+		r.AddCookie(cookie)
+	}
+	rec := httptest.NewRecorder()
+	handler(rec, r)
+	return rec
+}
+
+// postForm posts the form to the handler.
+func postForm(handler http.HandlerFunc, path string, cookie *http.Cookie, form url.Values) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodPost, path, strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return serve(handler, r, cookie)
+}
+
+func TestPostsNeedCSRFToken(t *testing.T) {
+	setupSite(t)
+	addTestUser(t, "alice", &config.UserConfig{Username: "alice"})
+	cookie, csrfToken := startTestSession(t, "alice")
+
+	tests := []struct {
+		name       string
+		form       url.Values
+		wantStatus int
+	}{
+		{name: "no token", form: url.Values{}, wantStatus: http.StatusForbidden},
+		{name: "wrong token", form: url.Values{csrfField: {"forged"}}, wantStatus: http.StatusForbidden},
+		{name: "session token", form: url.Values{csrfField: {csrfToken}}, wantStatus: http.StatusSeeOther},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := postForm(ApproveSyncHandler, "/approve_sync", cookie, tt.form)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			userCfg, _ := lookupUser("alice")
+			if approved := tt.wantStatus == http.StatusSeeOther; userCfg.ApproveNextSync != approved {
+				t.Errorf("ApproveNextSync = %v, want %v", userCfg.ApproveNextSync, approved)
+			}
+		})
+	}
+}
+
+func TestDashboardEscapesMessageAndHasCSRFToken(t *testing.T) {
+	setupSite(t)
+	addTestUser(t, "alice", &config.UserConfig{Username: "alice"})
+	cookie, csrfToken := startTestSession(t, "alice")
+
+	r := httptest.NewRequest(http.MethodGet, "/dashboard?message="+url.QueryEscape("<script>alert(1)</script>"), nil)
+	rec := serve(DashboardHandler, r, cookie)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", rec.Code)
+	}
+	body := rec.Body.String()
+	if strings.Contains(body, "<script>alert(1)</script>") {
+		t.Errorf("dashboard shows the message unescaped")
+	}
+	if !strings.Contains(body, "&lt;script&gt;alert(1)&lt;/script&gt;") {
+		t.Errorf("dashboard does not show the escaped message")
+	}
+	if !strings.Contains(body, `name="csrf_token" value="`+csrfToken+`"`) {
+		t.Errorf("dashboard forms do not hold the session's CSRF token")
+	}
+
+	// Saving the dashboard form needs the token too
+	rec = postForm(DashboardHandler, "/dashboard", cookie, url.Values{"username": {"mallory"}})
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("dashboard POST without token: status = %d, want 403", rec.Code)
+	}
+	if userCfg, _ := lookupUser("alice"); userCfg.Username != "alice" {
+		t.Errorf("FunTech username changed to %q by a form without a token", userCfg.Username)
+	}
+}
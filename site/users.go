@@ -0,0 +1,138 @@
+package site
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"log"
+	"sync"
+
+	"funtech-scraper/config"
+)
+
+// users holds the config of every user, as last loaded from userStore. The configs in it are never
+// changed in place: handlers get copies, and changes are saved to the store and replace the entry.
+var (
+	usersMu sync.RWMutex
+	users   = make(map[string]*config.UserConfig)
+)
+
+// LoadUserConfigs loads every user from the store, which the site then saves users to.
+func LoadUserConfigs(s config.UserStore) error {
+	userStore = s
+	return reloadUsers()
+}
+
+// WatchUserConfigs reloads the users whenever the store changes, so changes made by the daemon, such
+// as refreshed tokens, or by an admin editing a user, are seen without a restart. It returns when ctx
+// is done.
+func WatchUserConfigs(ctx context.Context) {
+	changes := userStore.Watch(ctx)
+	// Catch changes made between loading the users and starting to watch
+	if err := reloadUsers(); err != nil {
+		log.Printf("Error reloading user configs: %v", err)
+	}
+
+	for range changes {
+		if err := reloadUsers(); err != nil {
+			log.Printf("Error reloading user configs: %v", err)
+			continue
+		}
+		log.Printf("Reloaded user configs")
+	}
+}
+
+// reloadUsers replaces the users with the ones in the store. A user whose config cannot be loaded
+// is logged and keeps the config loaded before, if any, so one bad file does not stop the others
+// from being reloaded.
+func reloadUsers() error {
+	usernames, err := userStore.List()
+	if err != nil {
+		return err
+	}
+
+	loaded := make(map[string]*config.UserConfig, len(usernames))
+	var failed []string
+	for _, username := range usernames {
+		userCfg, err := userStore.Get(username)
+		if err != nil {
+			log.Printf("Error loading user config (%s), skipping it: %v", username, err)
+			failed = append(failed, username)
+			continue
+		}
+		loaded[username] = userCfg
+	}
+
+	usersMu.Lock()
+	for _, username := range failed {
+		if previous, ok := users[username]; ok {
+			loaded[username] = previous
+		}
+	}
+	users = loaded
+	usersMu.Unlock()
+	return nil
+}
+
+// lookupUser returns a copy of the user's config, which the caller may change freely.
+func lookupUser(username string) (*config.UserConfig, bool) {
+	usersMu.RLock()
+	defer usersMu.RUnlock()
+
+	userCfg, ok := users[username]
+	if !ok {
+		return nil, false
+	}
+	copied := *userCfg
+	return &copied, true
+}
+
+// updateUser changes the user's saved config with update, then keeps the result. Only the fields
+// update sets are changed, so changes saved by the daemon in the meantime are kept.
+func updateUser(username string, update func(*config.UserConfig) error) (*config.UserConfig, error) {
+	userCfg, err := userStore.Update(username, update)
+	if err != nil {
+		return nil, err
+	}
+
+	usersMu.Lock()
+	users[username] = userCfg
+	usersMu.Unlock()
+
+	copied := *userCfg
+	return &copied, nil
+}
+
+// addUser saves a new user, reporting false if the username is already taken.
+func addUser(username string, userCfg *config.UserConfig) (bool, error) {
+	usersMu.Lock()
+	defer usersMu.Unlock()
+
+	if _, exists := users[username]; exists {
+		return false, nil
+	}
+	// The user may have been added to the store since the users were last loaded
+	if _, err := userStore.Get(username); !errors.Is(err, config.ErrUserNotFound) {
+		return false, err
+	}
+	if err := userStore.Put(username, userCfg); err != nil {
+		return false, err
+	}
+	copied := *userCfg
+	users[username] = &copied
+	return true, nil
+}
+
+// userByFeedToken returns the name and a copy of the config of the user whose feed token is token.
+func userByFeedToken(token string) (string, *config.UserConfig, bool) {
+	usersMu.RLock()
+	defer usersMu.RUnlock()
+
+	for username, userCfg := range users {
+		if userCfg.FeedToken != "" && subtle.ConstantTimeCompare([]byte(userCfg.FeedToken), []byte(token)) == 1 {
+			copied := *userCfg
+			return username, &copied, true
+		}
+	}
+	return "", nil, false
+}
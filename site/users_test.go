@@ -0,0 +1,47 @@
+package site
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"funtech-scraper/config"
+)
+
+func TestReloadUsersSkipsBrokenConfigs(t *testing.T) {
+	setupSite(t)
+	dir := t.TempDir()
+	files := config.NewJSONDirStore(dir)
+	for _, username := range []string{"alice", "bob"} {
+		if err := files.Put(username, &config.UserConfig{Username: username}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := LoadUserConfigs(files); err != nil {
+		t.Fatal(err)
+	}
+
+	// Break bob's file, change alice's and add carol's
+	if err := os.WriteFile(filepath.Join(dir, "bob.json"), []byte("{not json"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := files.Put("alice", &config.UserConfig{Username: "alice.new"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := files.Put("carol", &config.UserConfig{Username: "carol"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := reloadUsers(); err != nil {
+		t.Fatalf("reloadUsers = %v, want the broken config skipped", err)
+	}
+
+	if userCfg, ok := lookupUser("alice"); !ok || userCfg.Username != "alice.new" {
+		t.Errorf("alice = %+v, %v, want the changed config", userCfg, ok)
+	}
+	if _, ok := lookupUser("carol"); !ok {
+		t.Errorf("carol was not loaded")
+	}
+	if userCfg, ok := lookupUser("bob"); !ok || userCfg.Username != "bob" {
+		t.Errorf("bob = %+v, %v, want the config loaded before it broke", userCfg, ok)
+	}
+}
@@ -0,0 +1,87 @@
+package store
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"funtech-scraper/scraper"
+)
+
+// recordLessonChanges saves the changes found by a scrape. The lessons before and after the change
+// are kept as JSON, as they are only ever read back whole.
+func recordLessonChanges(tx *sql.Tx, username string, changes []scraper.LessonChange) error {
+	for _, change := range changes {
+		oldLesson, err := encodeLesson(change.Old)
+		if err != nil {
+			return err
+		}
+		newLesson, err := encodeLesson(change.New)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(`INSERT INTO lesson_changes (username, lesson_key, kind, detected_at, old_lesson, new_lesson)
+			VALUES (?, ?, ?, ?, ?, ?)`,
+			username, change.Key, string(change.Kind), change.DetectedAt.UTC().Format(timeFormat), oldLesson, newLesson)
+		if err != nil {
+			return fmt.Errorf("error recording change to lesson %s: %v", change.Key, err)
+		}
+	}
+	return nil
+}
+
+// LessonChanges returns the user's most recent lesson changes, newest first.
+func (s *Store) LessonChanges(username string, limit int) ([]scraper.LessonChange, error) {
+	rows, err := s.db.Query(`SELECT lesson_key, kind, detected_at, old_lesson, new_lesson FROM lesson_changes
+		WHERE username = ? ORDER BY id DESC LIMIT ?`, username, limit)
+	if err != nil {
+		return nil, fmt.Errorf("error reading lesson changes: %v", err)
+	}
+	defer rows.Close()
+
+	var changes []scraper.LessonChange
+	for rows.Next() {
+		var change scraper.LessonChange
+		var kind, detectedAt string
+		var oldLesson, newLesson sql.NullString
+		if err := rows.Scan(&change.Key, &kind, &detectedAt, &oldLesson, &newLesson); err != nil {
+			return nil, fmt.Errorf("error reading lesson changes: %v", err)
+		}
+		change.Kind = scraper.LessonChangeKind(kind)
+		if change.DetectedAt, err = time.Parse(timeFormat, detectedAt); err != nil {
+			return nil, fmt.Errorf("invalid detection time for change to lesson %s: %v", change.Key, err)
+		}
+		if err := decodeLesson(oldLesson, &change.Old); err != nil {
+			return nil, err
+		}
+		if err := decodeLesson(newLesson, &change.New); err != nil {
+			return nil, err
+		}
+		changes = append(changes, change)
+	}
+	return changes, rows.Err()
+}
+
+// encodeLesson encodes a lesson for a change record; missing lessons are stored as NULL.
+func encodeLesson(lesson scraper.Lesson) (sql.NullString, error) {
+	if lesson.Key == "" {
+		return sql.NullString{}, nil
+	}
+	data, err := json.Marshal(lesson)
+	if err != nil {
+		return sql.NullString{}, fmt.Errorf("error encoding lesson %s: %v", lesson.Key, err)
+	}
+	return sql.NullString{String: string(data), Valid: true}, nil
+}
+
+// decodeLesson decodes a lesson stored by encodeLesson.
+func decodeLesson(data sql.NullString, lesson *scraper.Lesson) error {
+	if !data.Valid {
+		return nil
+	}
+	if err := json.Unmarshal([]byte(data.String), lesson); err != nil {
+		return fmt.Errorf("error decoding lesson: %v", err)
+	}
+	return nil
+}
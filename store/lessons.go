@@ -0,0 +1,269 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"funtech-scraper/scraper"
+)
+
+const (
+	timeFormat = "2006-01-02T15:04:05.000000000Z" // Always UTC, so stored times sort as text
+	dateFormat = "2006-01-02"
+)
+
+// LessonRecord is a stored lesson with when the scraper first and last saw it.
+type LessonRecord struct {
+	scraper.Lesson
+	FirstSeen time.Time
+	LastSeen  time.Time
+	RemovedAt time.Time // When the lesson disappeared from the timetable, zero while it is listed
+}
+
+// Removed reports whether the lesson is no longer on the timetable.
+func (r LessonRecord) Removed() bool {
+	return !r.RemovedAt.IsZero()
+}
+
+// RecordScrape saves the outcome of scraping the user's timetable and returns how the lessons changed
+// since the last scrape. Scraped lessons are added or refreshed; lessons missing from a fully scraped
+// week are marked as removed, but kept for history. Weeks that failed or skipped rows leave their
+// lessons as they were. Lessons in weeks never scraped before are not reported as added, and a
+// lesson moved to another day of its week is reported as rescheduled rather than cancelled and added.
+func (s *Store) RecordScrape(username string, results []scraper.ScrapeResult) ([]scraper.LessonChange, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	var changes []scraper.LessonChange
+	for _, result := range results {
+		fetchedAt := result.FetchedAt
+		if fetchedAt.IsZero() {
+			fetchedAt = time.Now()
+		}
+		seen := fetchedAt.UTC().Format(timeFormat)
+		weekKey := result.Week.Key()
+
+		// Step 1: Record when the week was scraped and how it went, noting whether it was known before
+		var weekKnown bool
+		err := tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM lessons WHERE username = ? AND week_key = ?)
+			OR EXISTS (SELECT 1 FROM week_scrapes WHERE username = ? AND week_key = ? AND status <> ?)`,
+			username, weekKey, username, weekKey, string(scraper.ScrapeFailed)).Scan(&weekKnown)
+		if err != nil {
+			return nil, fmt.Errorf("error reading previous scrapes of week %s: %v", weekKey, err)
+		}
+		errText := ""
+		if result.Err != nil {
+			errText = result.Err.Error()
+		}
+		_, err = tx.Exec(`INSERT INTO week_scrapes (username, week_key, status, error, warnings, fetched_at)
+			VALUES (?, ?, ?, ?, ?, ?)
+			ON CONFLICT (username, week_key) DO UPDATE SET
+				status = excluded.status, error = excluded.error, warnings = excluded.warnings, fetched_at = excluded.fetched_at`,
+			username, weekKey, string(result.Status), errText, len(result.Warnings), seen)
+		if err != nil {
+			return nil, fmt.Errorf("error recording scrape of week %s: %v", weekKey, err)
+		}
+		if result.Status == scraper.ScrapeFailed {
+			continue
+		}
+
+		// Step 2: Add new lessons and refresh known ones, bringing back any that had been removed
+		var weekChanges []scraper.LessonChange
+		for _, lesson := range result.Lessons {
+			previous, err := scanLessonRecord(tx.QueryRow(`SELECT `+lessonColumns+` FROM lessons WHERE username = ? AND lesson_key = ?`,
+				username, lesson.Key))
+			switch {
+			case err == sql.ErrNoRows:
+				if weekKnown {
+					weekChanges = append(weekChanges, scraper.LessonChange{Kind: scraper.LessonAdded, Key: lesson.Key, DetectedAt: fetchedAt, New: lesson})
+				}
+			case err != nil:
+				return nil, err
+			case previous.Removed():
+				weekChanges = append(weekChanges, scraper.LessonChange{Kind: scraper.LessonAdded, Key: lesson.Key, DetectedAt: fetchedAt, New: lesson})
+			default:
+				if change := scraper.CompareLessons(previous.Lesson, lesson); change != nil {
+					change.DetectedAt = fetchedAt
+					weekChanges = append(weekChanges, *change)
+				}
+			}
+
+			_, err = tx.Exec(`INSERT INTO lessons (username, lesson_key, week_key, course, day, start_time, end_time, date, lesson_type, first_seen, last_seen)
+				VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+				ON CONFLICT (username, lesson_key) DO UPDATE SET
+					week_key = excluded.week_key, course = excluded.course, day = excluded.day,
+					start_time = excluded.start_time, end_time = excluded.end_time, date = excluded.date,
+					lesson_type = excluded.lesson_type, last_seen = excluded.last_seen, removed_at = NULL`,
+				username, lesson.Key, lesson.WeekKey, lesson.Course, lesson.Day, lesson.StartTime, lesson.EndTime,
+				lesson.Date.Format(dateFormat), lesson.LessonType, seen, seen)
+			if err != nil {
+				return nil, fmt.Errorf("error saving lesson %s: %v", lesson.Key, err)
+			}
+		}
+
+		// Step 3: Mark lessons of the week that were not scraped as removed, unless rows were skipped
+		if len(result.Warnings) == 0 {
+			removed, err := queryLessonRecords(tx, `WHERE username = ? AND week_key = ? AND removed_at IS NULL AND last_seen <> ?`,
+				username, weekKey, seen)
+			if err != nil {
+				return nil, err
+			}
+			for _, record := range removed {
+				weekChanges = append(weekChanges, scraper.LessonChange{Kind: scraper.LessonCancelled, Key: record.Key, DetectedAt: fetchedAt, Old: record.Lesson})
+			}
+			_, err = tx.Exec(`UPDATE lessons SET removed_at = ?
+				WHERE username = ? AND week_key = ? AND removed_at IS NULL AND last_seen <> ?`,
+				seen, username, weekKey, seen)
+			if err != nil {
+				return nil, fmt.Errorf("error marking removed lessons of week %s: %v", weekKey, err)
+			}
+		}
+
+		// Step 4: Report a lesson cancelled and one of the same course added this week as moved
+		changes = append(changes, scraper.MatchReschedules(weekChanges)...)
+	}
+
+	if err := recordLessonChanges(tx, username, changes); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("error saving scrape: %v", err)
+	}
+	return changes, nil
+}
+
+// ScrapeRemovals counts the lessons RecordScrape would mark as removed for the results, and the
+// user's lessons on the timetable now, so a scrape that came back empty can be refused first.
+func (s *Store) ScrapeRemovals(username string, results []scraper.ScrapeResult) (removed, listed int, err error) {
+	err = s.db.QueryRow(`SELECT COUNT(*) FROM lessons WHERE username = ? AND removed_at IS NULL`, username).Scan(&listed)
+	if err != nil {
+		return 0, 0, fmt.Errorf("error counting lessons: %v", err)
+	}
+
+	for _, result := range results {
+		if result.Status == scraper.ScrapeFailed || len(result.Warnings) > 0 {
+			continue
+		}
+		scraped := make(map[string]bool)
+		for _, lesson := range result.Lessons {
+			scraped[lesson.Key] = true
+		}
+		records, err := s.queryLessons(`WHERE username = ? AND week_key = ? AND removed_at IS NULL`, username, result.Week.Key())
+		if err != nil {
+			return 0, 0, err
+		}
+		for _, record := range records {
+			if !scraped[record.Key] {
+				removed++
+			}
+		}
+	}
+	return removed, listed, nil
+}
+
+// Lessons returns the user's lessons that are on the timetable, in date order.
+func (s *Store) Lessons(username string) ([]scraper.Lesson, error) {
+	records, err := s.queryLessons(`WHERE username = ? AND removed_at IS NULL`, username)
+	if err != nil {
+		return nil, err
+	}
+
+	lessons := make([]scraper.Lesson, 0, len(records))
+	for _, record := range records {
+		lessons = append(lessons, record.Lesson)
+	}
+	return lessons, nil
+}
+
+// LessonHistory returns every lesson the user has had, including removed ones, in date order.
+func (s *Store) LessonHistory(username string) ([]LessonRecord, error) {
+	return s.queryLessons(`WHERE username = ?`, username)
+}
+
+// LastScraped returns when the user's timetable was last scraped successfully, or the zero time if
+// it never was.
+func (s *Store) LastScraped(username string) (time.Time, error) {
+	var fetchedAt sql.NullString
+	err := s.db.QueryRow(`SELECT MAX(fetched_at) FROM week_scrapes WHERE username = ? AND status <> ?`,
+		username, string(scraper.ScrapeFailed)).Scan(&fetchedAt)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("error reading last scrape for %s: %v", username, err)
+	}
+	if !fetchedAt.Valid {
+		return time.Time{}, nil
+	}
+	return time.Parse(timeFormat, fetchedAt.String)
+}
+
+// lessonColumns are the columns scanLessonRecord reads.
+const lessonColumns = `lesson_key, week_key, course, day, start_time, end_time, date, lesson_type, first_seen, last_seen, removed_at`
+
+// querier runs queries on the database or in a transaction.
+type querier interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// scanner is a row from Query or QueryRow.
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// queryLessons reads the lessons matching the where clause.
+func (s *Store) queryLessons(where string, args ...interface{}) ([]LessonRecord, error) {
+	return queryLessonRecords(s.db, where, args...)
+}
+
+// queryLessonRecords reads the lessons matching the where clause, in date order.
+func queryLessonRecords(q querier, where string, args ...interface{}) ([]LessonRecord, error) {
+	rows, err := q.Query(`SELECT `+lessonColumns+` FROM lessons `+where+` ORDER BY date, start_time, lesson_key`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error reading lessons: %v", err)
+	}
+	defer rows.Close()
+
+	var records []LessonRecord
+	for rows.Next() {
+		record, err := scanLessonRecord(rows)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+	return records, rows.Err()
+}
+
+// scanLessonRecord reads a lesson selected with lessonColumns. It returns sql.ErrNoRows unwrapped.
+func scanLessonRecord(row scanner) (LessonRecord, error) {
+	var record LessonRecord
+	var date, firstSeen, lastSeen string
+	var removedAt sql.NullString
+	err := row.Scan(&record.Key, &record.WeekKey, &record.Course, &record.Day, &record.StartTime, &record.EndTime,
+		&date, &record.LessonType, &firstSeen, &lastSeen, &removedAt)
+	if err == sql.ErrNoRows {
+		return record, err
+	}
+	if err != nil {
+		return record, fmt.Errorf("error reading lessons: %v", err)
+	}
+
+	// Lesson dates are calendar days; the lesson times are in UK time, see scraper.LessonToEvent
+	if record.Date, err = time.Parse(dateFormat, date); err != nil {
+		return record, fmt.Errorf("invalid date for lesson %s: %v", record.Key, err)
+	}
+	if record.FirstSeen, err = time.Parse(timeFormat, firstSeen); err != nil {
+		return record, fmt.Errorf("invalid first seen time for lesson %s: %v", record.Key, err)
+	}
+	if record.LastSeen, err = time.Parse(timeFormat, lastSeen); err != nil {
+		return record, fmt.Errorf("invalid last seen time for lesson %s: %v", record.Key, err)
+	}
+	if removedAt.Valid {
+		if record.RemovedAt, err = time.Parse(timeFormat, removedAt.String); err != nil {
+			return record, fmt.Errorf("invalid removal time for lesson %s: %v", record.Key, err)
+		}
+	}
+	return record, nil
+}
@@ -0,0 +1,136 @@
+package store
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"funtech-scraper/scraper"
+)
+
+// scrapeWeek builds the result of scraping the week starting 23/09/2024 with a lesson of the
+// course on each of the given days, 0 being Monday.
+func scrapeWeek(course, start, end string, days ...int) scraper.ScrapeResult {
+	week := scraper.Week{Year: "2024-25", Term: 1, WeekNumber: 1, StartDate: "23/09/2024"}
+	result := scraper.ScrapeResult{Week: week, Status: scraper.ScrapeOK, FetchedAt: time.Now()}
+	for _, day := range days {
+		date := time.Date(2024, time.September, 23+day, 0, 0, 0, 0, time.UTC)
+		result.Lessons = append(result.Lessons, scraper.Lesson{
+			Key:       scraper.LessonKey(week, date.Weekday().String(), course, 0),
+			WeekKey:   week.Key(),
+			Course:    course,
+			Day:       date.Weekday().String(),
+			StartTime: start,
+			EndTime:   end,
+			Date:      date,
+		})
+	}
+	return result
+}
+
+func TestRecordScrapeReportsReschedules(t *testing.T) {
+	tests := []struct {
+		name   string
+		before scraper.ScrapeResult
+		after  scraper.ScrapeResult
+		want   []string
+	}{
+		{
+			name:   "moved to a later time",
+			before: scrapeWeek("Python L2", "16:00", "17:00", 3),
+			after:  scrapeWeek("Python L2", "17:00", "17:00", 3),
+			want:   []string{"Thursday 26/09 16:00 Python L2 moved to 17:00"},
+		},
+		{
+			name:   "moved to another day",
+			before: scrapeWeek("Python L2", "16:00", "17:00", 3),
+			after:  scrapeWeek("Python L2", "16:00", "17:00", 4),
+			want:   []string{"Thursday 26/09 16:00 Python L2 moved to Friday 27/09 16:00"},
+		},
+		{
+			name:   "cancelled",
+			before: scrapeWeek("Python L2", "16:00", "17:00", 3, 4),
+			after:  scrapeWeek("Python L2", "16:00", "17:00", 4),
+			want:   []string{"Cancelled: Thursday 26/09 16:00 Python L2"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := openTestStore(t)
+			if _, err := s.RecordScrape("alice", []scraper.ScrapeResult{tt.before}); err != nil {
+				t.Fatal(err)
+			}
+			changes, err := s.RecordScrape("alice", []scraper.ScrapeResult{tt.after})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var got []string
+			for _, change := range changes {
+				got = append(got, change.String())
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("changes = %q, want %q", got, tt.want)
+			}
+
+			lessons, err := s.Lessons("alice")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(lessons) != len(tt.after.Lessons) {
+				t.Errorf("%d lessons on the timetable, want %d", len(lessons), len(tt.after.Lessons))
+			}
+		})
+	}
+}
+
+func TestScrapeRemovals(t *testing.T) {
+	empty := scrapeWeek("Python L2", "16:00", "17:00")
+	empty.Status = scraper.ScrapeEmpty
+	failed := scrapeWeek("Python L2", "16:00", "17:00")
+	failed.Status = scraper.ScrapeFailed
+	warned := scrapeWeek("Python L2", "16:00", "17:00")
+	warned.Warnings = []scraper.ParseWarning{{}}
+
+	tests := []struct {
+		name        string
+		after       scraper.ScrapeResult
+		wantRemoved int
+	}{
+		{name: "unchanged", after: scrapeWeek("Python L2", "16:00", "17:00", 0, 1, 2, 3), wantRemoved: 0},
+		{name: "one cancelled", after: scrapeWeek("Python L2", "16:00", "17:00", 0, 1, 2), wantRemoved: 1},
+		{name: "empty week", after: empty, wantRemoved: 4},
+		{name: "failed week", after: failed, wantRemoved: 0},
+		{name: "skipped rows", after: warned, wantRemoved: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := openTestStore(t)
+			if _, err := s.RecordScrape("alice", []scraper.ScrapeResult{scrapeWeek("Python L2", "16:00", "17:00", 0, 1, 2, 3)}); err != nil {
+				t.Fatal(err)
+			}
+
+			removed, listed, err := s.ScrapeRemovals("alice", []scraper.ScrapeResult{tt.after})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if removed != tt.wantRemoved || listed != 4 {
+				t.Errorf("ScrapeRemovals = %d of %d, want %d of 4", removed, listed, tt.wantRemoved)
+			}
+
+			// The count must match what recording the scrape actually removes
+			if _, err := s.RecordScrape("alice", []scraper.ScrapeResult{tt.after}); err != nil {
+				t.Fatal(err)
+			}
+			lessons, err := s.Lessons("alice")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := listed - len(lessons); got != removed {
+				t.Errorf("RecordScrape removed %d lessons, ScrapeRemovals counted %d", got, removed)
+			}
+		})
+	}
+}
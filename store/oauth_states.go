@@ -0,0 +1,68 @@
+package store
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base64"
+	"fmt"
+	"time"
+)
+
+// CreateOAuthState starts a Google authorisation for the user from a browser session. It returns the
+// random state to send to Google, which is valid once, for ttl, and only from the same session. The
+// PKCE verifier is kept with it for the code exchange.
+func (s *Store) CreateOAuthState(sessionID, username, verifier string, ttl time.Duration) (string, error) {
+	stateBytes := make([]byte, 32)
+	if _, err := rand.Read(stateBytes); err != nil {
+		return "", fmt.Errorf("error creating OAuth state: %v", err)
+	}
+	state := base64.RawURLEncoding.EncodeToString(stateBytes)
+
+	now := time.Now().UTC()
+	if _, err := s.db.Exec(`DELETE FROM oauth_states WHERE expires_at < ?`, now.Format(timeFormat)); err != nil {
+		return "", fmt.Errorf("error deleting expired OAuth states: %v", err)
+	}
+	_, err := s.db.Exec(`INSERT INTO oauth_states (state_hash, session_hash, username, verifier, expires_at) VALUES (?, ?, ?, ?, ?)`,
+		hashToken(state), hashToken(sessionID), username, verifier, now.Add(ttl).Format(timeFormat))
+	if err != nil {
+		return "", fmt.Errorf("error saving OAuth state for %s: %v", username, err)
+	}
+	return state, nil
+}
+
+// ConsumeOAuthState checks the state Google sent back with an authorisation, deleting it so it cannot
+// be used again. It returns the user the authorisation is for and the PKCE verifier, or reports false
+// if the state is unknown, expired or was created by another session.
+func (s *Store) ConsumeOAuthState(state, sessionID string) (username, verifier string, ok bool, err error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return "", "", false, fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	var sessionHash, expiresAt string
+	err = tx.QueryRow(`SELECT session_hash, username, verifier, expires_at FROM oauth_states WHERE state_hash = ?`,
+		hashToken(state)).Scan(&sessionHash, &username, &verifier, &expiresAt)
+	if err == sql.ErrNoRows {
+		return "", "", false, nil
+	}
+	if err != nil {
+		return "", "", false, fmt.Errorf("error reading OAuth state: %v", err)
+	}
+	if _, err := tx.Exec(`DELETE FROM oauth_states WHERE state_hash = ?`, hashToken(state)); err != nil {
+		return "", "", false, fmt.Errorf("error deleting OAuth state: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return "", "", false, fmt.Errorf("error deleting OAuth state: %v", err)
+	}
+
+	expires, err := time.Parse(timeFormat, expiresAt)
+	if err != nil {
+		return "", "", false, fmt.Errorf("invalid OAuth state expiry time: %v", err)
+	}
+	if time.Now().After(expires) || subtle.ConstantTimeCompare([]byte(sessionHash), []byte(hashToken(sessionID))) != 1 {
+		return "", "", false, nil
+	}
+	return username, verifier, true, nil
+}
@@ -0,0 +1,52 @@
+package store
+
+import (
+	"testing"
+	"time"
+)
+
+func TestConsumeOAuthState(t *testing.T) {
+	tests := []struct {
+		name      string
+		ttl       time.Duration
+		sessionID string // Session the callback comes from
+		consumed  bool   // Whether the state was used before
+		wantOK    bool
+	}{
+		{name: "valid", ttl: time.Minute, sessionID: "session", wantOK: true},
+		{name: "replayed", ttl: time.Minute, sessionID: "session", consumed: true},
+		{name: "other session", ttl: time.Minute, sessionID: "other session"},
+		{name: "expired", ttl: -time.Minute, sessionID: "session"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := openTestStore(t)
+			state, err := s.CreateOAuthState("session", "alice", "verifier", tt.ttl)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.consumed {
+				if _, _, ok, err := s.ConsumeOAuthState(state, "session"); err != nil || !ok {
+					t.Fatalf("first ConsumeOAuthState = %v, %v, want ok", ok, err)
+				}
+			}
+
+			username, verifier, ok, err := s.ConsumeOAuthState(state, tt.sessionID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ok != tt.wantOK {
+				t.Fatalf("ConsumeOAuthState ok = %v, want %v", ok, tt.wantOK)
+			}
+			if ok && (username != "alice" || verifier != "verifier") {
+				t.Errorf("ConsumeOAuthState = %q, %q, want alice and its verifier", username, verifier)
+			}
+
+			// Whatever the outcome, the state cannot be used again
+			if _, _, ok, err := s.ConsumeOAuthState(state, "session"); err != nil || ok {
+				t.Errorf("state used again = %v, %v, want rejected", ok, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,144 @@
+package store
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"time"
+)
+
+// Session is a login to the web server.
+type Session struct {
+	Username  string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+}
+
+// CreateSession starts a session for the user that lasts for ttl and returns its ID. Only a hash of
+// the ID is stored, so the database cannot be used to take over sessions.
+func (s *Store) CreateSession(username string, ttl time.Duration) (string, error) {
+	id, err := randomToken()
+	if err != nil {
+		return "", fmt.Errorf("error creating session ID: %v", err)
+	}
+	csrfToken, err := randomToken()
+	if err != nil {
+		return "", fmt.Errorf("error creating CSRF token: %v", err)
+	}
+
+	now := time.Now()
+	// Clear out expired sessions while we are here
+	if _, err := s.db.Exec(`DELETE FROM sessions WHERE expires_at < ?`, now.UTC().Format(timeFormat)); err != nil {
+		return "", fmt.Errorf("error deleting expired sessions: %v", err)
+	}
+	_, err = s.db.Exec(`INSERT INTO sessions (id_hash, username, created_at, expires_at, csrf_token) VALUES (?, ?, ?, ?, ?)`,
+		hashToken(id), username, now.UTC().Format(timeFormat), now.Add(ttl).UTC().Format(timeFormat), csrfToken)
+	if err != nil {
+		return "", fmt.Errorf("error saving session for %s: %v", username, err)
+	}
+	return id, nil
+}
+
+// SessionUser returns the user a session belongs to and the token the session's forms must send back,
+// so other sites cannot post forms on the user's behalf. It reports false if there is no such session
+// or it has expired.
+func (s *Store) SessionUser(id string) (username, csrfToken string, ok bool, err error) {
+	err = s.db.QueryRow(`SELECT username, csrf_token FROM sessions WHERE id_hash = ? AND expires_at > ?`,
+		hashToken(id), time.Now().UTC().Format(timeFormat)).Scan(&username, &csrfToken)
+	if err == sql.ErrNoRows {
+		return "", "", false, nil
+	}
+	if err != nil {
+		return "", "", false, fmt.Errorf("error reading session: %v", err)
+	}
+
+	// Sessions started before CSRF tokens were kept are given one. Another request may give it one
+	// at the same time, so the token that was saved is read back.
+	if csrfToken == "" {
+		newToken, err := randomToken()
+		if err != nil {
+			return "", "", false, fmt.Errorf("error creating CSRF token: %v", err)
+		}
+		_, err = s.db.Exec(`UPDATE sessions SET csrf_token = ? WHERE id_hash = ? AND csrf_token = ''`, newToken, hashToken(id))
+		if err != nil {
+			return "", "", false, fmt.Errorf("error saving CSRF token: %v", err)
+		}
+		err = s.db.QueryRow(`SELECT csrf_token FROM sessions WHERE id_hash = ?`, hashToken(id)).Scan(&csrfToken)
+		if err != nil {
+			return "", "", false, fmt.Errorf("error reading session: %v", err)
+		}
+	}
+	return username, csrfToken, true, nil
+}
+
+// DeleteSession ends a session, e.g. when the user logs out.
+func (s *Store) DeleteSession(id string) error {
+	if _, err := s.db.Exec(`DELETE FROM sessions WHERE id_hash = ?`, hashToken(id)); err != nil {
+		return fmt.Errorf("error deleting session: %v", err)
+	}
+	return nil
+}
+
+// DeleteUserSessions ends all of a user's sessions, or everyone's if username is empty. It returns how
+// many sessions were ended.
+func (s *Store) DeleteUserSessions(username string) (int, error) {
+	var result sql.Result
+	var err error
+	if username == "" {
+		result, err = s.db.Exec(`DELETE FROM sessions`)
+	} else {
+		result, err = s.db.Exec(`DELETE FROM sessions WHERE username = ?`, username)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("error deleting sessions: %v", err)
+	}
+	deleted, err := result.RowsAffected()
+	return int(deleted), err
+}
+
+// Sessions returns the sessions that have not expired, of one user or of everyone if username is
+// empty, oldest first.
+func (s *Store) Sessions(username string) ([]Session, error) {
+	rows, err := s.db.Query(`SELECT username, created_at, expires_at FROM sessions
+		WHERE (? = '' OR username = ?) AND expires_at > ? ORDER BY created_at`,
+		username, username, time.Now().UTC().Format(timeFormat))
+	if err != nil {
+		return nil, fmt.Errorf("error reading sessions: %v", err)
+	}
+	defer rows.Close()
+
+	var sessions []Session
+	for rows.Next() {
+		var session Session
+		var createdAt, expiresAt string
+		if err := rows.Scan(&session.Username, &createdAt, &expiresAt); err != nil {
+			return nil, fmt.Errorf("error reading sessions: %v", err)
+		}
+		if session.CreatedAt, err = time.Parse(timeFormat, createdAt); err != nil {
+			return nil, fmt.Errorf("invalid session creation time: %v", err)
+		}
+		if session.ExpiresAt, err = time.Parse(timeFormat, expiresAt); err != nil {
+			return nil, fmt.Errorf("invalid session expiry time: %v", err)
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions, rows.Err()
+}
+
+// randomToken returns 32 random bytes encoded for use in URLs and cookies.
+func randomToken() (string, error) {
+	token := make([]byte, 32)
+	if _, err := rand.Read(token); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(token), nil
+}
+
+// hashToken returns the hash a session ID or OAuth state is stored under.
+func hashToken(id string) string {
+	sum := sha256.Sum256([]byte(id))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,100 @@
+package store
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSessionUser(t *testing.T) {
+	s := openTestStore(t)
+	id, err := s.CreateSession("alice", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	username, csrfToken, ok, err := s.SessionUser(id)
+	if err != nil || !ok || username != "alice" {
+		t.Fatalf("SessionUser = %q, %v, %v, want alice", username, ok, err)
+	}
+	if csrfToken == "" {
+		t.Errorf("session has no CSRF token")
+	}
+
+	// Only the hash of the ID is stored, so neither it nor the CSRF token finds the session
+	var stored int
+	if err := s.db.QueryRow(`SELECT COUNT(*) FROM sessions WHERE id_hash = ?`, id).Scan(&stored); err != nil {
+		t.Fatal(err)
+	}
+	if stored != 0 {
+		t.Errorf("session ID stored in plaintext")
+	}
+	for _, other := range []string{hashToken(id), csrfToken, ""} {
+		if _, _, ok, err := s.SessionUser(other); err != nil || ok {
+			t.Errorf("SessionUser(%q) = %v, %v, want no session", other, ok, err)
+		}
+	}
+}
+
+func TestSessionUserRejectsEndedSessions(t *testing.T) {
+	tests := []struct {
+		name string
+		end  func(s *Store, id string) error
+	}{
+		{
+			name: "expired",
+			end: func(s *Store, id string) error {
+				_, err := s.db.Exec(`UPDATE sessions SET expires_at = ? WHERE id_hash = ?`,
+					time.Now().Add(-time.Minute).UTC().Format(timeFormat), hashToken(id))
+				return err
+			},
+		},
+		{
+			name: "logged out",
+			end:  func(s *Store, id string) error { return s.DeleteSession(id) },
+		},
+		{
+			name: "revoked",
+			end: func(s *Store, id string) error {
+				_, err := s.DeleteUserSessions("alice")
+				return err
+			},
+		},
+		{
+			name: "everyone revoked",
+			end: func(s *Store, id string) error {
+				_, err := s.DeleteUserSessions("")
+				return err
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := openTestStore(t)
+			id, err := s.CreateSession("alice", time.Hour)
+			if err != nil {
+				t.Fatal(err)
+			}
+			other, err := s.CreateSession("bob", time.Hour)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err := tt.end(s, id); err != nil {
+				t.Fatal(err)
+			}
+			if _, _, ok, err := s.SessionUser(id); err != nil || ok {
+				t.Errorf("SessionUser after the session ended = %v, %v, want no session", ok, err)
+			}
+			if sessions, err := s.Sessions("alice"); err != nil || len(sessions) != 0 {
+				t.Errorf("Sessions = %v, %v, want none", sessions, err)
+			}
+
+			// Other users stay logged in unless everyone was logged out
+			_, _, ok, err := s.SessionUser(other)
+			if wantOK := tt.name != "everyone revoked"; err != nil || ok != wantOK {
+				t.Errorf("other user's SessionUser = %v, %v, want %v", ok, err, wantOK)
+			}
+		})
+	}
+}
@@ -0,0 +1,138 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	_ "modernc.org/sqlite"
+)
+
+// DefaultPath is where the daemon and the web server keep their shared database.
+const DefaultPath = "config/ftcalendar.db"
+
+const schema = `
+CREATE TABLE IF NOT EXISTS lessons (
+	username    TEXT NOT NULL,
+	lesson_key  TEXT NOT NULL,
+	week_key    TEXT NOT NULL,
+	course      TEXT NOT NULL,
+	day         TEXT NOT NULL,
+	start_time  TEXT NOT NULL,
+	end_time    TEXT NOT NULL,
+	date        TEXT NOT NULL,
+	lesson_type INTEGER NOT NULL,
+	first_seen  TEXT NOT NULL,
+	last_seen   TEXT NOT NULL,
+	removed_at  TEXT,
+	PRIMARY KEY (username, lesson_key)
+);
+CREATE INDEX IF NOT EXISTS lessons_by_week ON lessons (username, week_key);
+
+CREATE TABLE IF NOT EXISTS week_scrapes (
+	username   TEXT NOT NULL,
+	week_key   TEXT NOT NULL,
+	status     TEXT NOT NULL,
+	error      TEXT NOT NULL,
+	warnings   INTEGER NOT NULL,
+	fetched_at TEXT NOT NULL,
+	PRIMARY KEY (username, week_key)
+);
+
+CREATE TABLE IF NOT EXISTS lesson_changes (
+	id          INTEGER PRIMARY KEY AUTOINCREMENT,
+	username    TEXT NOT NULL,
+	lesson_key  TEXT NOT NULL,
+	kind        TEXT NOT NULL,
+	detected_at TEXT NOT NULL,
+	old_lesson  TEXT,
+	new_lesson  TEXT
+);
+CREATE INDEX IF NOT EXISTS lesson_changes_by_user ON lesson_changes (username, id);
+
+CREATE TABLE IF NOT EXISTS sync_runs (
+	id       INTEGER PRIMARY KEY AUTOINCREMENT,
+	username TEXT NOT NULL,
+	time     TEXT NOT NULL,
+	status   TEXT NOT NULL,
+	reason   TEXT NOT NULL,
+	inserts  INTEGER NOT NULL,
+	updates  INTEGER NOT NULL,
+	deletes  INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS sync_runs_by_user ON sync_runs (username, id);
+
+CREATE TABLE IF NOT EXISTS sessions (
+	id_hash    TEXT PRIMARY KEY,
+	username   TEXT NOT NULL,
+	created_at TEXT NOT NULL,
+	expires_at TEXT NOT NULL,
+	csrf_token TEXT NOT NULL DEFAULT ''
+);
+CREATE INDEX IF NOT EXISTS sessions_by_user ON sessions (username);
+
+CREATE TABLE IF NOT EXISTS users (
+	username   TEXT PRIMARY KEY,
+	config     TEXT NOT NULL,
+	updated_at TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS oauth_states (
+	state_hash   TEXT PRIMARY KEY,
+	session_hash TEXT NOT NULL,
+	username     TEXT NOT NULL,
+	verifier     TEXT NOT NULL,
+	expires_at   TEXT NOT NULL
+);
+`
+
+// Store is the local database shared by the daemon and the web server.
+type Store struct {
+	db *sql.DB
+}
+
+// Open opens the database at path, creating it and its tables if needed. Both the daemon and the
+// web server open it, so writers wait for each other rather than failing. Transactions take the write
+// lock when they begin, as they all write.
+func Open(path string) (*Store, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create directory for database %s: %v", path, err)
+	}
+
+	db, err := sql.Open("sqlite", "file:"+path+"?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_txlock=immediate")
+	if err != nil {
+		return nil, fmt.Errorf("error opening database %s: %v", path, err)
+	}
+	if _, err := db.Exec(schema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("error creating tables in database %s: %v", path, err)
+	}
+	// Sessions started before CSRF tokens were kept get one when they are next used
+	if err := addColumn(db, "sessions", "csrf_token", `TEXT NOT NULL DEFAULT ''`); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("error updating tables in database %s: %v", path, err)
+	}
+	return &Store{db: db}, nil
+}
+
+// addColumn adds a column to a table created before the column was in the schema.
+func addColumn(db *sql.DB, table, column, definition string) error {
+	var exists bool
+	err := db.QueryRow(`SELECT EXISTS (SELECT 1 FROM pragma_table_info(?) WHERE name = ?)`, table, column).Scan(&exists)
+	if err != nil {
+		return fmt.Errorf("error reading columns of %s: %v", table, err)
+	}
+	if exists {
+		return nil
+	}
+	if _, err := db.Exec(fmt.Sprintf(`ALTER TABLE %s ADD COLUMN %s %s`, table, column, definition)); err != nil {
+		return fmt.Errorf("error adding column %s to %s: %v", column, table, err)
+	}
+	return nil
+}
+
+// Close closes the database.
+func (s *Store) Close() error {
+	return s.db.Close()
+}
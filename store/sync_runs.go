@@ -0,0 +1,73 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// syncRunsKept is how many of each user's most recent sync runs are kept.
+const syncRunsKept = 100
+
+// SyncRun statuses
+const (
+	SyncRunOK      = "ok"
+	SyncRunBlocked = "blocked"
+	SyncRunFailed  = "failed"
+)
+
+// SyncRun records the outcome of one calendar sync for a user.
+type SyncRun struct {
+	Time    time.Time
+	Status  string
+	Reason  string
+	Inserts int
+	Updates int
+	Deletes int
+}
+
+// RecordSyncRun saves a sync run for the user, dropping their oldest runs beyond syncRunsKept.
+func (s *Store) RecordSyncRun(username string, run SyncRun) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`INSERT INTO sync_runs (username, time, status, reason, inserts, updates, deletes)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		username, run.Time.UTC().Format(timeFormat), run.Status, run.Reason, run.Inserts, run.Updates, run.Deletes)
+	if err != nil {
+		return fmt.Errorf("error recording sync run for %s: %v", username, err)
+	}
+	_, err = tx.Exec(`DELETE FROM sync_runs WHERE username = ? AND id NOT IN
+		(SELECT id FROM sync_runs WHERE username = ? ORDER BY id DESC LIMIT ?)`,
+		username, username, syncRunsKept)
+	if err != nil {
+		return fmt.Errorf("error dropping old sync runs for %s: %v", username, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error recording sync run for %s: %v", username, err)
+	}
+	return nil
+}
+
+// LastSyncRun returns the most recent sync run recorded for the user, or nil if there is none.
+func (s *Store) LastSyncRun(username string) (*SyncRun, error) {
+	var run SyncRun
+	var runTime string
+	err := s.db.QueryRow(`SELECT time, status, reason, inserts, updates, deletes FROM sync_runs
+		WHERE username = ? ORDER BY id DESC LIMIT 1`, username).
+		Scan(&runTime, &run.Status, &run.Reason, &run.Inserts, &run.Updates, &run.Deletes)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading last sync run for %s: %v", username, err)
+	}
+	if run.Time, err = time.Parse(timeFormat, runTime); err != nil {
+		return nil, fmt.Errorf("invalid time for last sync run of %s: %v", username, err)
+	}
+	return &run, nil
+}
@@ -0,0 +1,56 @@
+package store
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func openTestStore(t *testing.T) *Store {
+	t.Helper()
+	s, err := Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func TestSyncRunsKeepsRecentRuns(t *testing.T) {
+	s := openTestStore(t)
+
+	if run, err := s.LastSyncRun("alice"); err != nil || run != nil {
+		t.Fatalf("LastSyncRun before any run = %v, %v, want nil", run, err)
+	}
+
+	start := time.Date(2024, time.September, 23, 9, 0, 0, 0, time.UTC)
+	for i := 0; i < syncRunsKept+5; i++ {
+		run := SyncRun{Time: start.Add(time.Duration(i) * time.Minute), Status: SyncRunOK, Inserts: i}
+		if err := s.RecordSyncRun("alice", run); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.RecordSyncRun("bob", SyncRun{Time: start, Status: SyncRunBlocked, Reason: "too many deletes"}); err != nil {
+		t.Fatal(err)
+	}
+
+	run, err := s.LastSyncRun("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if run.Inserts != syncRunsKept+4 || !run.Time.Equal(start.Add((syncRunsKept+4)*time.Minute)) {
+		t.Errorf("last run = %+v, want the one recorded last", run)
+	}
+
+	var count int
+	if err := s.db.QueryRow(`SELECT COUNT(*) FROM sync_runs WHERE username = ?`, "alice").Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+	if count != syncRunsKept {
+		t.Errorf("kept %d runs, want %d", count, syncRunsKept)
+	}
+
+	if run, err := s.LastSyncRun("bob"); err != nil || run.Status != SyncRunBlocked {
+		t.Errorf("bob's last run = %+v, %v, want his blocked run", run, err)
+	}
+}
@@ -0,0 +1,154 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"funtech-scraper/config"
+)
+
+// UserStore keeps user configs in the users table, encrypted as in the JSON files. It implements
+// config.UserStore.
+type UserStore struct {
+	db *sql.DB
+}
+
+// Users returns the user store backed by the database.
+func (s *Store) Users() *UserStore {
+	return &UserStore{db: s.db}
+}
+
+// OpenUserStore returns the user store chosen by "user_store" in the common config: the JSON files
+// in config/user_configs by default, or the users table of s for "sqlite".
+func OpenUserStore(commonCfg *config.CommonConfig, s *Store) (config.UserStore, error) {
+	switch commonCfg.UserStore {
+	case "", "json":
+		return config.NewJSONDirStore(config.DefaultUserConfigDir), nil
+	case "sqlite":
+		return s.Users(), nil
+	default:
+		return nil, fmt.Errorf("unknown user store %q", commonCfg.UserStore)
+	}
+}
+
+// Get loads the user's config, encrypting its secrets again if needed.
+func (u *UserStore) Get(username string) (*config.UserConfig, error) {
+	userCfg, stale, err := getUser(u.db, username)
+	if err != nil {
+		return nil, err
+	}
+	return config.ReencryptIfStale(u, username, userCfg, stale)
+}
+
+// List returns the names of all users, in order.
+func (u *UserStore) List() ([]string, error) {
+	rows, err := u.db.Query(`SELECT username FROM users ORDER BY username`)
+	if err != nil {
+		return nil, fmt.Errorf("error listing users: %v", err)
+	}
+	defer rows.Close()
+
+	var usernames []string
+	for rows.Next() {
+		var username string
+		if err := rows.Scan(&username); err != nil {
+			return nil, fmt.Errorf("error listing users: %v", err)
+		}
+		usernames = append(usernames, username)
+	}
+	return usernames, rows.Err()
+}
+
+// Put saves the user's config, replacing any saved before. Names the JSON store could not save are
+// refused too, so users can be moved between the stores.
+func (u *UserStore) Put(username string, userCfg *config.UserConfig) error {
+	if err := config.ValidateUsername(username); err != nil {
+		return err
+	}
+	return putUser(u.db, username, userCfg)
+}
+
+// Update reads, updates and saves the user's config in one transaction.
+func (u *UserStore) Update(username string, update func(*config.UserConfig) error) (*config.UserConfig, error) {
+	tx, err := u.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	userCfg, _, err := getUser(tx, username)
+	if err != nil {
+		return nil, err
+	}
+	if err := update(userCfg); err != nil {
+		return nil, err
+	}
+	if err := putUser(tx, username, userCfg); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("error saving user config for %s: %v", username, err)
+	}
+	return userCfg, nil
+}
+
+// Delete removes the user's config.
+func (u *UserStore) Delete(username string) error {
+	if _, err := u.db.Exec(`DELETE FROM users WHERE username = ?`, username); err != nil {
+		return fmt.Errorf("error deleting user config for %s: %v", username, err)
+	}
+	return nil
+}
+
+// Watch polls the table for users that were added, changed or deleted.
+func (u *UserStore) Watch(ctx context.Context) <-chan struct{} {
+	return config.PollForChanges(ctx, config.WatchInterval, func() (string, error) {
+		var count int
+		var updatedAt string
+		err := u.db.QueryRow(`SELECT COUNT(*), COALESCE(MAX(updated_at), '') FROM users`).Scan(&count, &updatedAt)
+		if err != nil {
+			return "", fmt.Errorf("error reading users: %v", err)
+		}
+		return fmt.Sprintf("%d %s", count, updatedAt), nil
+	})
+}
+
+// execer runs statements on the database or in a transaction.
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// rowQuerier reads single rows from the database or in a transaction.
+type rowQuerier interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// getUser reads and decrypts the user's config, reporting whether its secrets need encrypting again.
+func getUser(q rowQuerier, username string) (*config.UserConfig, bool, error) {
+	var data string
+	err := q.QueryRow(`SELECT config FROM users WHERE username = ?`, username).Scan(&data)
+	if err == sql.ErrNoRows {
+		return nil, false, config.ErrUserNotFound
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("error reading user config for %s: %v", username, err)
+	}
+	return config.DecodeUserConfig([]byte(data))
+}
+
+// putUser encrypts and saves the user's config.
+func putUser(e execer, username string, userCfg *config.UserConfig) error {
+	data, err := config.EncodeUserConfig(userCfg)
+	if err != nil {
+		return err
+	}
+	_, err = e.Exec(`INSERT INTO users (username, config, updated_at) VALUES (?, ?, ?)
+		ON CONFLICT (username) DO UPDATE SET config = excluded.config, updated_at = excluded.updated_at`,
+		username, string(data), time.Now().UTC().Format(timeFormat))
+	if err != nil {
+		return fmt.Errorf("error saving user config for %s: %v", username, err)
+	}
+	return nil
+}